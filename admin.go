@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+)
+
+// middlewareAdmin admits requests bearing the admin key. It is sent as
+// "Authorization: Bearer <key>", the same scheme personal API keys use.
+func (cfg *apiConfig) middlewareAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.adminKey == "" {
+			respondWithError(w, http.StatusForbidden, "Admin API is disabled")
+			return
+		}
+
+		key, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't find API key")
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(key), []byte(cfg.adminKey)) != 1 {
+			respondWithError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), moderatorKey{}, adminKeyModerator(key))
+		next(w, r.WithContext(ctx))
+	}
+}
+
+type moderatorKey struct{}
+
+// adminKeyModerator names a moderator who authenticated with the admin key.
+// The key is shared, so it is told apart by a fingerprint, which changes
+// when the key is rotated.
+func adminKeyModerator(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "admin-key:" + hex.EncodeToString(sum[:4])
+}
+
+// moderator returns who middlewareAdmin authenticated, as recorded in the
+// audit log and on closed reports.
+func moderator(r *http.Request) string {
+	m, _ := r.Context().Value(moderatorKey{}).(string)
+	return m
+}
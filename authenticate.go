@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+)
+
+var (
+	errUnauthenticated = errors.New("Couldn't validate credentials")
+	errMissingScope    = errors.New("Credentials lack the required scope")
+)
+
+// middlewareAuth rejects requests without credentials granting scope and
+// stores the caller's auth.Principal in the request context.
+func (cfg *apiConfig) middlewareAuth(scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := cfg.authenticate(r, scope)
+		if errors.Is(err, errMissingScope) {
+			respondWithError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, errUnauthenticated.Error())
+			return
+		}
+
+		next(w, r.WithContext(auth.ContextWithPrincipal(r.Context(), principal)))
+	}
+}
+
+// middlewareOptionalAuth is middlewareAuth for routes anonymous callers may
+// use too. Missing or unusable credentials leave the context empty.
+func (cfg *apiConfig) middlewareOptionalAuth(scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := cfg.authenticate(r, scope)
+		if err == nil {
+			r = r.WithContext(auth.ContextWithPrincipal(r.Context(), principal))
+		}
+
+		next(w, r)
+	}
+}
+
+// authenticate identifies the caller from an access token or a personal
+// API key and checks it holds scope.
+func (cfg *apiConfig) authenticate(r *http.Request, scope auth.Scope) (auth.Principal, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return auth.Principal{}, errUnauthenticated
+	}
+
+	var principal auth.Principal
+	if strings.HasPrefix(token, auth.APIKeyPrefix) {
+		principal, err = cfg.apiKeyPrincipal(token, scope)
+	} else {
+		principal, err = cfg.accessTokenPrincipal(token)
+	}
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	if !principal.HasScope(scope) {
+		return auth.Principal{}, errMissingScope
+	}
+
+	return principal, nil
+}
+
+// accessTokenPrincipal accepts first-party access tokens, which carry every
+// scope, and those issued to OAuth clients, which carry what the user
+// consented to.
+func (cfg *apiConfig) accessTokenPrincipal(token string) (auth.Principal, error) {
+	claims, err := auth.ParseToken(token, cfg.keyring, auth.TokenTypeAccess)
+	if err != nil {
+		return auth.Principal{}, errUnauthenticated
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return auth.Principal{}, errUnauthenticated
+	}
+
+	user, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		return auth.Principal{}, errUnauthenticated
+	}
+
+	if user.TokenRevoked(claims.IssuedAt.Time) || user.PendingDeletion() {
+		return auth.Principal{}, errUnauthenticated
+	}
+
+	isRevoked, err := cfg.DB.IsTokenRevoked(auth.HashToken(token))
+	if err != nil || isRevoked {
+		return auth.Principal{}, errUnauthenticated
+	}
+
+	if !cfg.sessionActive(claims, userID) {
+		return auth.Principal{}, errUnauthenticated
+	}
+
+	principal := auth.Principal{
+		UserID:    userID,
+		TokenType: auth.TokenTypeAccess,
+		Scopes:    auth.AccessTokenScopes,
+	}
+	if claims.ClientID != "" {
+		principal.ClientID = claims.ClientID
+		principal.Scopes = nil
+		for _, s := range auth.ParseScope(claims.Scope) {
+			if auth.IsValidScope(s) {
+				principal.Scopes = append(principal.Scopes, s)
+			}
+		}
+	}
+
+	return principal, nil
+}
+
+// sessionActive reports whether the session an access token was issued in
+// is still active and, for OAuth tokens, whether the client still exists.
+// Revoking the session or deleting the client cuts off its access tokens
+// as well as its refresh token.
+func (cfg *apiConfig) sessionActive(claims auth.Claims, userID int) bool {
+	session, err := cfg.DB.GetSession(claims.SessionID)
+	if err != nil {
+		return false
+	}
+	if session.UserID != userID ||
+		session.ClientID != claims.ClientID ||
+		!session.Active(time.Now().UTC()) {
+		return false
+	}
+
+	if claims.ClientID != "" {
+		_, err = cfg.DB.GetOAuthClient(claims.ClientID)
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// apiKeyPrincipal looks the key up and records its use. Uses that fail the
+// scope check aren't recorded.
+func (cfg *apiConfig) apiKeyPrincipal(token string, scope auth.Scope) (auth.Principal, error) {
+	id, ok := auth.ParseAPIKey(token)
+	if !ok {
+		return auth.Principal{}, errUnauthenticated
+	}
+
+	key, err := cfg.DB.GetAPIKey(id)
+	if err != nil {
+		return auth.Principal{}, errUnauthenticated
+	}
+
+	now := time.Now().UTC()
+	if !auth.CheckTokenHash(token, key.KeyHash) || !key.Active(now) {
+		return auth.Principal{}, errUnauthenticated
+	}
+
+	user, err := cfg.DB.GetUser(key.UserID)
+	if err != nil || user.PendingDeletion() {
+		return auth.Principal{}, errUnauthenticated
+	}
+
+	principal := auth.Principal{
+		UserID:    key.UserID,
+		TokenType: auth.TokenTypeAPIKey,
+	}
+	for _, s := range key.Scopes {
+		principal.Scopes = append(principal.Scopes, auth.Scope(s))
+	}
+
+	if principal.HasScope(scope) {
+		err = cfg.DB.TouchAPIKey(key.ID, now)
+		if err != nil {
+			log.Printf("Couldn't record use of API key %s: %s", key.ID, err)
+		}
+	}
+
+	return principal, nil
+}
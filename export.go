@@ -0,0 +1,173 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+// exportTTL is how long a finished export can be downloaded.
+const exportTTL = 7 * 24 * time.Hour
+
+func (cfg *apiConfig) exportPath(exportID string) string {
+	return filepath.Join(cfg.exportsDir, exportID+".zip")
+}
+
+// buildExport writes the archive for an export and records the outcome.
+func (cfg *apiConfig) buildExport(export database.DataExport) {
+	status := database.ExportStatusReady
+	err := cfg.writeExportArchive(export)
+	if err != nil {
+		log.Printf("Couldn't build export %s: %s", export.ID, err)
+		status = database.ExportStatusFailed
+		os.Remove(cfg.exportPath(export.ID))
+	}
+
+	_, err = cfg.DB.CompleteExport(export.ID, status, time.Now().UTC().Add(exportTTL))
+	if err != nil {
+		log.Printf("Couldn't update export %s: %s", export.ID, err)
+	}
+}
+
+func (cfg *apiConfig) writeExportArchive(export database.DataExport) error {
+	data, err := cfg.DB.GetUserData(export.UserID)
+	if err != nil {
+		return err
+	}
+
+	sessions := make([]Session, 0, len(data.Sessions))
+	for _, family := range data.Sessions {
+		sessions = append(sessions, sessionFromDB(family))
+	}
+
+	apiKeys := make([]APIKey, 0, len(data.APIKeys))
+	for _, key := range data.APIKeys {
+		apiKeys = append(apiKeys, apiKeyFromDB(key))
+	}
+
+	oauthClients := make([]OAuthClient, 0, len(data.OAuthClients))
+	for _, client := range data.OAuthClients {
+		oauthClients = append(oauthClients, oauthClientFromDB(client))
+	}
+
+	files := map[string]interface{}{
+		"profile.json":  exportProfile(data.User),
+		"chirps.json":   data.Chirps,
+		"reports.json":  data.Reports,
+		"blocks.json":   data.Blocks,
+		"mutes.json":    data.Mutes,
+		"sessions.json": sessions,
+		"api_keys.json": apiKeys,
+		"exports.json":  data.Exports,
+
+		"oauth_clients.json":  oauthClients,
+		"oauth_consents.json": data.OAuthConsents,
+	}
+
+	err = os.MkdirAll(cfg.exportsDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(cfg.exportPath(export.ID), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		dat, err := json.MarshalIndent(content, "", "  ")
+		if err != nil {
+			return err
+		}
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(dat)
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// exportProfile is the user record without credentials.
+func exportProfile(user database.User) interface{} {
+	type profile struct {
+		User
+		State     database.AccountState `json:"state"`
+		CreatedAt time.Time             `json:"created_at"`
+	}
+	return profile{
+		User:      userFromDB(user),
+		State:     user.EffectiveState(time.Now().UTC()),
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+// exportSignature authenticates a download link so it can be opened
+// without a bearer token until it expires.
+func (cfg *apiConfig) exportSignature(exportID string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(cfg.jwtSecret))
+	fmt.Fprintf(mac, "export:%s:%d", exportID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (cfg *apiConfig) exportDownloadURL(export database.DataExport) string {
+	expires := export.ExpiresAt.Unix()
+	return fmt.Sprintf(
+		"/api/users/export/%s/download?expires=%d&signature=%s",
+		export.ID,
+		expires,
+		cfg.exportSignature(export.ID, expires),
+	)
+}
+
+// cleanupExports deletes expired exports and archives that no longer have
+// an export record, checking every interval.
+func (cfg *apiConfig) cleanupExports(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		entries, err := os.ReadDir(cfg.exportsDir)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				log.Printf("Couldn't list exports: %s", err)
+			}
+			continue
+		}
+
+		now := time.Now().UTC()
+		for _, entry := range entries {
+			exportID, ok := strings.CutSuffix(entry.Name(), ".zip")
+			if !ok {
+				continue
+			}
+
+			export, err := cfg.DB.GetExport(exportID)
+			if err == nil && (export.Status == database.ExportStatusPending || now.Before(export.ExpiresAt)) {
+				continue
+			}
+
+			os.Remove(cfg.exportPath(exportID))
+			if err == nil {
+				cfg.DB.DeleteExport(exportID)
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nt2311-vn/Chirpy/internal/profanity"
+)
+
+func (cfg *apiConfig) handlerProfanityGet(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, cfg.profanity.Rules())
+}
+
+func (cfg *apiConfig) handlerProfanityUpdate(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	rules := []profanity.Rule{}
+	err := decoder.Decode(&rules)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	err = cfg.profanity.SetRules(rules)
+	if err != nil {
+		if errors.Is(err, profanity.ErrInvalidRule) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update rules")
+		return
+	}
+
+	if cfg.profanityFile != "" {
+		err = cfg.profanity.SaveFile(cfg.profanityFile)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't save rules")
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.profanity.Rules())
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+// AdminReport is a report as moderators see it, including who filed it.
+type AdminReport struct {
+	ID         int        `json:"id"`
+	ReporterID int        `json:"reporter_id"`
+	TargetType string     `json:"target_type"`
+	TargetID   int        `json:"target_id"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy string     `json:"resolved_by,omitempty"`
+}
+
+func adminReportFromDB(report database.Report) AdminReport {
+	adminReport := AdminReport{
+		ID:         report.ID,
+		ReporterID: report.ReporterID,
+		TargetType: string(report.TargetType),
+		TargetID:   report.TargetID,
+		Reason:     string(report.Reason),
+		Details:    report.Details,
+		Status:     string(report.Status),
+		CreatedAt:  report.CreatedAt,
+		ResolvedBy: report.ResolvedBy,
+	}
+	if !report.ResolvedAt.IsZero() {
+		adminReport.ResolvedAt = &report.ResolvedAt
+	}
+	return adminReport
+}
+
+type ModerationAction struct {
+	ID         int       `json:"id"`
+	Moderator  string    `json:"moderator"`
+	Action     string    `json:"action"`
+	ReportID   int       `json:"report_id,omitempty"`
+	TargetType string    `json:"target_type"`
+	TargetID   int       `json:"target_id"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func moderationActionFromDB(action database.ModerationAction) ModerationAction {
+	return ModerationAction{
+		ID:         action.ID,
+		Moderator:  action.Moderator,
+		Action:     string(action.Action),
+		ReportID:   action.ReportID,
+		TargetType: string(action.TargetType),
+		TargetID:   action.TargetID,
+		Note:       action.Note,
+		CreatedAt:  action.CreatedAt,
+	}
+}
+
+func (cfg *apiConfig) handlerAdminReportsList(w http.ResponseWriter, r *http.Request) {
+	status := database.ReportStatus(r.URL.Query().Get("status"))
+	if status == "" {
+		status = database.ReportStatusOpen
+	}
+	if status == "all" {
+		status = ""
+	}
+
+	dbReports, err := cfg.DB.GetReportsByStatus(status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve reports")
+		return
+	}
+
+	reports := make([]AdminReport, 0, len(dbReports))
+	for _, report := range dbReports {
+		reports = append(reports, adminReportFromDB(report))
+	}
+
+	respondWithJSON(w, http.StatusOK, reports)
+}
+
+func (cfg *apiConfig) handlerAdminReportsAction(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Action string `json:"action"`
+		Note   string `json:"note"`
+	}
+
+	reportID, err := strconv.Atoi(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid report ID")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	action := database.ModerationActionType(params.Action)
+	switch action {
+	case database.ModerationActionHideChirp, database.ModerationActionSuspendUser, database.ModerationActionDismiss:
+	default:
+		respondWithError(w, http.StatusBadRequest, "Invalid action")
+		return
+	}
+
+	report, err := cfg.DB.ActOnReport(reportID, action, moderator(r), params.Note)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find report or its target")
+		return
+	}
+	if errors.Is(err, database.ErrReportClosed) {
+		respondWithError(w, http.StatusConflict, "Report is already closed")
+		return
+	}
+	if errors.Is(err, database.ErrActionNotApplicable) {
+		respondWithError(w, http.StatusBadRequest, "Report is not about a chirp")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't apply action")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, adminReportFromDB(report))
+}
+
+func (cfg *apiConfig) handlerAdminAuditLog(w http.ResponseWriter, r *http.Request) {
+	dbActions, err := cfg.DB.GetModerationActions()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve audit log")
+		return
+	}
+
+	actions := make([]ModerationAction, 0, len(dbActions))
+	for _, action := range dbActions {
+		actions = append(actions, moderationActionFromDB(action))
+	}
+
+	respondWithJSON(w, http.StatusOK, actions)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerAdminUserStateUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		State            string `json:"state"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+		Note             string `json:"note"`
+	}
+	type response struct {
+		ID             int       `json:"id"`
+		State          string    `json:"state"`
+		StateExpiresAt time.Time `json:"state_expires_at"`
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	state := database.AccountState(params.State)
+	if !database.IsValidAccountState(state) {
+		respondWithError(w, http.StatusBadRequest, "Invalid account state")
+		return
+	}
+
+	if params.ExpiresInSeconds < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid expiry")
+		return
+	}
+	expiresAt := time.Time{}
+	if params.ExpiresInSeconds > 0 {
+		expiresAt = time.Now().UTC().Add(time.Duration(params.ExpiresInSeconds) * time.Second)
+	}
+
+	user, err := cfg.DB.SetUserState(userID, state, expiresAt)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user")
+		return
+	}
+
+	_, err = cfg.DB.LogModerationAction(database.ModerationAction{
+		Moderator:  moderator(r),
+		Action:     database.ModerationActionSetState,
+		TargetType: database.ReportTargetUser,
+		TargetID:   user.ID,
+		Note:       params.Note,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record action")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		ID:             user.ID,
+		State:          string(user.State),
+		StateExpiresAt: user.StateExpiresAt,
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+	"github.com/nt2311-vn/Chirpy/internal/validation"
+)
+
+// maxAPIKeys caps the active keys a user can hold.
+const maxAPIKeys = 20
+
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+func apiKeyFromDB(key database.APIKey) APIKey {
+	apiKey := APIKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+	if !key.LastUsedAt.IsZero() {
+		apiKey.LastUsedAt = &key.LastUsedAt
+	}
+	if !key.ExpiresAt.IsZero() {
+		apiKey.ExpiresAt = &key.ExpiresAt
+	}
+	return apiKey
+}
+
+// handlerAPIKeysCreate issues a personal API key. The key itself is only
+// ever returned in this response.
+func (cfg *apiConfig) handlerAPIKeysCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name             string   `json:"name"`
+		Scopes           []string `json:"scopes"`
+		ExpiresInSeconds int      `json:"expires_in_seconds"`
+	}
+	type response struct {
+		APIKey
+		Key string `json:"key"`
+	}
+
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	errs := validation.Errors{}
+	if params.Name == "" || len(params.Name) > 100 {
+		errs.Add("name", "must be between 1 and 100 characters")
+	}
+	if len(params.Scopes) == 0 {
+		errs.Add("scopes", "must include at least one scope")
+	}
+	scopes := []string{}
+	for _, scope := range params.Scopes {
+		if !auth.IsValidScope(auth.Scope(scope)) {
+			errs.Add("scopes", fmt.Sprintf("unknown scope %q", scope))
+			continue
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if params.ExpiresInSeconds < 0 {
+		errs.Add("expires_in_seconds", "must not be negative")
+	}
+	if errs.Err() != nil {
+		respondWithFieldErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	existing, err := cfg.DB.GetAPIKeys(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve API keys")
+		return
+	}
+	if len(existing) >= maxAPIKeys {
+		respondWithError(w, http.StatusConflict, "Too many API keys, revoke one first")
+		return
+	}
+
+	id, key, err := auth.MakeAPIKey()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create API key")
+		return
+	}
+
+	expiresAt := time.Time{}
+	if params.ExpiresInSeconds > 0 {
+		expiresAt = time.Now().UTC().Add(time.Duration(params.ExpiresInSeconds) * time.Second)
+	}
+
+	dbKey, err := cfg.DB.CreateAPIKey(database.APIKey{
+		ID:        id,
+		UserID:    userID,
+		Name:      params.Name,
+		KeyHash:   auth.HashToken(key),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create API key")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response{
+		APIKey: apiKeyFromDB(dbKey),
+		Key:    key,
+	})
+}
+
+func (cfg *apiConfig) handlerAPIKeysGet(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	dbKeys, err := cfg.DB.GetAPIKeys(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve API keys")
+		return
+	}
+
+	keys := make([]APIKey, 0, len(dbKeys))
+	for _, dbKey := range dbKeys {
+		keys = append(keys, apiKeyFromDB(dbKey))
+	}
+
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+func (cfg *apiConfig) handlerAPIKeysDelete(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	err := cfg.DB.RevokeAPIKey(userID, r.PathValue("keyID"))
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find API key")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke API key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,17 +3,56 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
 
 	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+	"github.com/nt2311-vn/Chirpy/internal/profanity"
+	"github.com/nt2311-vn/Chirpy/internal/spam"
+	"github.com/nt2311-vn/Chirpy/internal/unfurl"
 )
 
 type Chirp struct {
-	ID       int    `json:"id"`
-	Body     string `json:"body"`
-	AuthorID int    `json:"author_id"`
+	ID       int      `json:"id"`
+	Body     string   `json:"body"`
+	AuthorID int      `json:"author_id"`
+	Preview  *Preview `json:"preview,omitempty"`
+	Held     bool     `json:"held,omitempty"`
+}
+
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	SiteName    string `json:"site_name"`
+}
+
+func chirpFromDB(dbChirp database.Chirp) Chirp {
+	chirp := Chirp{
+		ID:       dbChirp.ID,
+		Body:     dbChirp.Body,
+		AuthorID: dbChirp.AuthorID,
+		Held:     dbChirp.Held,
+	}
+	if dbChirp.Preview != nil {
+		chirp.Preview = &Preview{
+			URL:         dbChirp.Preview.URL,
+			Title:       dbChirp.Preview.Title,
+			Description: dbChirp.Preview.Description,
+			Image:       dbChirp.Preview.Image,
+			SiteName:    dbChirp.Preview.SiteName,
+		}
+	}
+	return chirp
 }
 
 func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request) {
@@ -21,21 +60,20 @@ func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request
 		Body string `json:"body"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
+	userID := auth.MustPrincipal(r.Context()).UserID
 
-		respondWithError(w, http.StatusUnauthorized, "Cannot find JWT")
+	user, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find user")
 		return
 	}
 
-	subject, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Could not find JWT")
+	if user.EffectiveState(time.Now().UTC()) == database.AccountStateSuspended {
+		respondWithError(w, http.StatusForbidden, "Account is suspended")
+		return
 	}
-
-	userID, err := strconv.Atoi(subject)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Could not parse user ID")
+	if cfg.requireVerifiedEmail && !user.EmailVerified {
+		respondWithError(w, http.StatusForbidden, "Email address is not verified")
 		return
 	}
 
@@ -47,48 +85,145 @@ func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	cleaned, err := validateChirp(params.Body)
+	cleaned, flagged, err := validateChirp(params.Body, cfg.profanity)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+		respondWithChirpError(w, err)
 		return
 	}
 
-	chirp, err := cfg.DB.CreateChirp(cleaned, userID)
+	recentChirps, err := cfg.DB.GetChirpsByAuthorID(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve recent chirps")
+		return
+	}
+	spamInput := spam.Input{
+		AuthorID:        userID,
+		AuthorCreatedAt: user.CreatedAt,
+		Body:            cleaned,
+	}
+	for _, recent := range recentChirps {
+		spamInput.Recent = append(spamInput.Recent, spam.RecentChirp{
+			Body:      recent.Body,
+			CreatedAt: recent.CreatedAt,
+		})
+	}
+	spamResult := cfg.spam.Evaluate(spamInput)
+	if spamResult.Verdict == spam.VerdictReject {
+		respondWithError(w, http.StatusBadRequest, "Chirp was rejected as spam")
+		return
+	}
+
+	review := database.ChirpReview{
+		Flagged: flagged,
+		Held:    spamResult.Verdict == spam.VerdictReview,
+	}
+	reviewReasons := []string{}
+	if review.Flagged {
+		reviewReasons = append(reviewReasons, "Matched a flagged word")
+	}
+	if review.Held {
+		for _, signal := range spamResult.Signals {
+			reviewReasons = append(reviewReasons, fmt.Sprintf("Spam check %s: %s", signal.Check, signal.Reason))
+		}
+	}
+	review.Reason = strings.Join(reviewReasons, "; ")
+
+	chirp, err := cfg.DB.CreateChirp(cleaned, userID, review)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, Chirp{
-		ID:       chirp.ID,
-		Body:     chirp.Body,
-		AuthorID: chirp.AuthorID,
-	})
+	if urls := unfurl.FindURLs(chirp.Body); len(urls) > 0 && cfg.unfurler != nil {
+		cfg.unfurler.Enqueue(unfurl.Job{ChirpID: chirp.ID, URL: urls[0]})
+	}
+
+	if chirp.Held {
+		respondWithJSON(w, http.StatusAccepted, chirpFromDB(chirp))
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, chirpFromDB(chirp))
 }
 
-func validateChirp(body string) (string, error) {
-	const maxChirpLength = 140
-	if len(body) > maxChirpLength {
-		return "", errors.New("Chirp is too long")
+func respondWithChirpError(w http.ResponseWriter, err error) {
+	type lengthErrorResponse struct {
+		Error  string `json:"error"`
+		Length int    `json:"length"`
+		Limit  int    `json:"limit"`
 	}
 
-	badWords := map[string]struct{}{
-		"kerfuffle": {},
-		"sharbert":  {},
-		"fornax":    {},
+	var lengthErr chirpLengthError
+	if errors.As(err, &lengthErr) {
+		respondWithJSON(w, http.StatusBadRequest, lengthErrorResponse{
+			Error:  lengthErr.Error(),
+			Length: lengthErr.Length,
+			Limit:  lengthErr.Limit,
+		})
+		return
 	}
-	cleaned := getCleanedBody(body, badWords)
-	return cleaned, nil
+
+	respondWithError(w, http.StatusBadRequest, err.Error())
+}
+
+const (
+	maxChirpLength = 140
+	// urlWeight is how many characters a URL counts for, regardless of its
+	// real length.
+	urlWeight = 23
+)
+
+var errChirpInvalidEncoding = errors.New("Chirp is not valid UTF-8")
+
+var errChirpControlCharacter = errors.New("Chirp contains control characters")
+
+var errChirpBannedWord = errors.New("Chirp contains banned words")
+
+type chirpLengthError struct {
+	Length int
+	Limit  int
 }
 
-func getCleanedBody(body string, badWords map[string]struct{}) string {
-	words := strings.Split(body, " ")
-	for i, word := range words {
-		loweredWord := strings.ToLower(word)
-		if _, ok := badWords[loweredWord]; ok {
-			words[i] = "****"
+func (e chirpLengthError) Error() string {
+	return "Chirp is too long"
+}
+
+// validateChirp returns the normalized, filtered body and whether it should
+// be flagged for review.
+func validateChirp(body string, filter *profanity.Filter) (string, bool, error) {
+	if !utf8.ValidString(body) {
+		return "", false, errChirpInvalidEncoding
+	}
+
+	body = norm.NFC.String(body)
+	for _, r := range body {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return "", false, errChirpControlCharacter
+		}
+	}
+
+	length := chirpLength(body)
+	if length > maxChirpLength {
+		return "", false, chirpLengthError{
+			Length: length,
+			Limit:  maxChirpLength,
 		}
 	}
-	cleaned := strings.Join(words, " ")
-	return cleaned
+
+	result := filter.Check(body)
+	if result.Rejected {
+		return "", false, errChirpBannedWord
+	}
+
+	return result.Cleaned, result.Flagged, nil
+}
+
+// chirpLength counts user-perceived characters (grapheme clusters), with
+// every URL counted as urlWeight.
+func chirpLength(body string) int {
+	urls := unfurl.FindURLs(body)
+	for _, u := range urls {
+		body = strings.Replace(body, u, "", 1)
+	}
+	return uniseg.GraphemeClusterCount(body) + len(urls)*urlWeight
 }
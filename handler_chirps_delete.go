@@ -16,23 +16,7 @@ func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Cannot find JWT")
-		return
-	}
-
-	subject, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Could not find JWT")
-		return
-	}
-
-	userID, err := strconv.Atoi(subject)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Could not parse user ID")
-		return
-	}
+	userID := auth.MustPrincipal(r.Context()).UserID
 
 	chirp, err := cfg.DB.GetChirp(chirpID)
 	if err != nil {
@@ -51,5 +35,5 @@ func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, chirp)
+	respondWithJSON(w, http.StatusOK, chirpFromDB(chirp))
 }
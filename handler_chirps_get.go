@@ -4,6 +4,10 @@ import (
 	"net/http"
 	"sort"
 	"strconv"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
 )
 
 func (cfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
@@ -20,11 +24,17 @@ func (cfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, Chirp{
-		ID:       dbChirp.ID,
-		Body:     dbChirp.Body,
-		AuthorID: dbChirp.AuthorID,
-	})
+	chirps, err := cfg.visibleChirps([]database.Chirp{dbChirp}, viewerID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp")
+		return
+	}
+	if len(chirps) == 0 {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chirps[0])
 }
 
 func (cfg *apiConfig) handlerChirpsRetrieve(w http.ResponseWriter, r *http.Request) {
@@ -35,60 +45,34 @@ func (cfg *apiConfig) handlerChirpsRetrieve(w http.ResponseWriter, r *http.Reque
 	}
 	s := r.URL.Query().Get("author_id")
 
+	var dbChirps []database.Chirp
+	var err error
 	if s != "" {
 		authorID, err := strconv.Atoi(s)
 		if err != nil {
 			respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+			return
 		}
 
-		dbChirps, err := cfg.DB.GetChirpsByAuthorID(authorID)
+		dbChirps, err = cfg.DB.GetChirpsByAuthorID(authorID)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
 			return
-
-		}
-
-		chirps := []Chirp{}
-		for _, dbChirp := range dbChirps {
-			chirps = append(chirps, Chirp{
-				ID:       dbChirp.ID,
-				Body:     dbChirp.Body,
-				AuthorID: dbChirp.AuthorID,
-			})
 		}
-
-		if sortParam == "desc" {
-			sort.Slice(chirps, func(i, j int) bool {
-				return chirps[i].ID > chirps[j].ID
-			})
-			respondWithJSON(w, http.StatusOK, chirps)
+	} else {
+		dbChirps, err = cfg.DB.GetChirps()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
 			return
-
 		}
-
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].ID < chirps[j].ID
-		})
-		respondWithJSON(w, http.StatusOK, chirps)
-		return
-
 	}
 
-	dbChirps, err := cfg.DB.GetChirps()
+	chirps, err := cfg.visibleChirps(dbChirps, viewerID(r))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
 		return
 	}
 
-	chirps := []Chirp{}
-	for _, dbChirp := range dbChirps {
-		chirps = append(chirps, Chirp{
-			ID:       dbChirp.ID,
-			Body:     dbChirp.Body,
-			AuthorID: dbChirp.AuthorID,
-		})
-	}
-
 	if sortParam == "desc" {
 		sort.Slice(chirps, func(i, j int) bool {
 			return chirps[i].ID > chirps[j].ID
@@ -102,5 +86,59 @@ func (cfg *apiConfig) handlerChirpsRetrieve(w http.ResponseWriter, r *http.Reque
 		return chirps[i].ID < chirps[j].ID
 	})
 	respondWithJSON(w, http.StatusOK, chirps)
-	return
+}
+
+// viewerID returns the signed-in user, or 0 for anonymous requests.
+func viewerID(r *http.Request) int {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return 0
+	}
+	return principal.UserID
+}
+
+// visibleChirps drops chirps hidden by moderators, chirps by accounts
+// pending deletion, and chirps by authors the viewer has blocked, muted or
+// been blocked by. Chirps held for review and
+// chirps by shadowbanned authors are only shown to their author.
+func (cfg *apiConfig) visibleChirps(dbChirps []database.Chirp, viewerID int) ([]Chirp, error) {
+	shadowbanned, err := cfg.DB.GetUserIDsByState(database.AccountStateShadowbanned, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := map[int]struct{}{}
+	if viewerID != 0 {
+		filtered, err = cfg.DB.GetFilteredAuthorIDs(viewerID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pendingDeletion, err := cfg.DB.GetPendingDeletionUserIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	chirps := []Chirp{}
+	for _, dbChirp := range dbChirps {
+		if dbChirp.Hidden {
+			continue
+		}
+		if dbChirp.Held && dbChirp.AuthorID != viewerID {
+			continue
+		}
+		if _, ok := shadowbanned[dbChirp.AuthorID]; ok && dbChirp.AuthorID != viewerID {
+			continue
+		}
+		if _, ok := filtered[dbChirp.AuthorID]; ok {
+			continue
+		}
+		if _, ok := pendingDeletion[dbChirp.AuthorID]; ok {
+			continue
+		}
+		chirps = append(chirps, chirpFromDB(dbChirp))
+	}
+
+	return chirps, nil
 }
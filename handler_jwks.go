@@ -0,0 +1,14 @@
+package main
+
+import (
+	"net/http"
+)
+
+// handlerJWKS publishes the public signing keys so other services can
+// validate our tokens without holding a secret. Every key in
+// JWT_KEYS_DIR is listed, so a retired key's file should be kept there
+// until the tokens it signed have expired.
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.keyring.JWKS())
+}
@@ -2,23 +2,25 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+	"github.com/nt2311-vn/Chirpy/internal/validation"
 )
 
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password   string `json:"password"`
+		Email      string `json:"email"`
+		DeviceName string `json:"device_name"`
 	}
-	type response struct {
-		User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
-
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	err := decoder.Decode(&params)
@@ -27,33 +29,170 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.DB.GetUserByEmail(params.Email)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+	now := time.Now().UTC()
+	email := normalizeEmailField(validation.Errors{}, "email", params.Email)
+	ip := clientIP(r)
+
+	// Lockouts are keyed by email whether or not an account exists, so
+	// they don't reveal which emails are registered either.
+	attempt, ok := cfg.beginLoginAttempt(w, email, ip, now)
+	if !ok {
 		return
 	}
 
-	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	user, err := cfg.DB.GetUserByEmail(email)
+	if err != nil && !errors.Is(err, database.ErrNotExist) {
+		cfg.releaseLoginAttempt(attempt)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+	if err != nil {
+		cfg.passwords.CheckDummy(params.Password)
+	} else {
+		err = cfg.passwords.CheckLogin(params.Password, user.HashedPassword)
+	}
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid password")
+		cfg.recordLoginFailure(attempt, user)
+		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
 		return
 	}
+	cfg.releaseLoginAttempt(attempt)
 
-	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		time.Hour,
-		auth.TokenTypeAccess,
-	)
+	if cfg.passwords.NeedsRehash(user.HashedPassword) {
+		cfg.rehashPassword(user, params.Password)
+	}
+
+	if user.EffectiveState(time.Now().UTC()) == database.AccountStateSuspended {
+		respondWithError(w, http.StatusForbidden, "Account is suspended")
+		return
+	}
+
+	if user.MFAEnabled() {
+		cfg.respondWithMFAChallenge(w, user)
+		return
+	}
+
+	cfg.completeLogin(w, r, user, params.DeviceName)
+}
+
+// rehashPassword upgrades a hash made with an older algorithm or weaker
+// parameters while the plaintext is at hand. Failing to is only logged; the
+// old hash still works.
+func (cfg *apiConfig) rehashPassword(user database.User, password string) {
+	newHash, err := cfg.passwords.Hash(password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT")
+		log.Printf("Couldn't rehash password of user %d: %s", user.ID, err)
 		return
 	}
 
+	err = cfg.DB.RehashPassword(user.ID, user.HashedPassword, newHash)
+	if err != nil {
+		log.Printf("Couldn't rehash password of user %d: %s", user.ID, err)
+	}
+}
+
+// loginAttempt is a password or code check reserved against an email and
+// the IP it came from.
+type loginAttempt struct {
+	ip      string
+	account loginReservation
+	ipRes   loginReservation
+}
+
+// beginLoginAttempt reserves an attempt against the email and the IP. If
+// either is locked out it responds with 429 and returns false. Every
+// reserved attempt must end in recordLoginFailure or releaseLoginAttempt.
+func (cfg *apiConfig) beginLoginAttempt(w http.ResponseWriter, email, ip string, now time.Time) (loginAttempt, bool) {
+	attempt := loginAttempt{ip: ip}
+	var lockedUntil time.Time
+	var ok bool
+	attempt.account, lockedUntil, ok = cfg.accountLogins.tryAcquire(email, now)
+	if ok {
+		attempt.ipRes, lockedUntil, ok = cfg.ipLogins.tryAcquire(ip, now)
+		if !ok {
+			cfg.accountLogins.release(attempt.account)
+		}
+	}
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedUntil.Sub(now).Seconds()))))
+		respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+		return loginAttempt{}, false
+	}
+
+	return attempt, true
+}
+
+// releaseLoginAttempt takes back an attempt that didn't fail.
+func (cfg *apiConfig) releaseLoginAttempt(attempt loginAttempt) {
+	cfg.accountLogins.release(attempt.account)
+	cfg.ipLogins.release(attempt.ipRes)
+}
+
+// loginKey is the key an account's failed logins are counted under.
+func loginKey(user database.User) string {
+	return normalizeEmailField(validation.Errors{}, "email", user.Email)
+}
+
+// recordLoginFailure keeps a failed attempt counted and logs the lockouts
+// it caused. Account lockouts go in the audit log; user is zero when no
+// account has the email.
+func (cfg *apiConfig) recordLoginFailure(attempt loginAttempt, user database.User) {
+	lockout, count := attempt.account.lockout, attempt.account.count
+	if lockout > 0 && user.ID != 0 {
+		log.Printf("Locked logins for user %d for %s after %d failed attempts, last from %s", user.ID, lockout, count, attempt.ip)
+		_, err := cfg.DB.LogModerationAction(database.ModerationAction{
+			Moderator:  "system",
+			Action:     database.ModerationActionLockAccount,
+			TargetType: database.ReportTargetUser,
+			TargetID:   user.ID,
+			Note:       fmt.Sprintf("Logins locked for %s after %d failed attempts, last from %s", lockout, count, attempt.ip),
+		})
+		if err != nil {
+			log.Printf("Couldn't record lockout of user %d: %s", user.ID, err)
+		}
+	} else if lockout > 0 {
+		log.Printf("Locked logins for an unknown email for %s after %d failed attempts, last from %s", lockout, count, attempt.ip)
+	}
+
+	lockout, count = attempt.ipRes.lockout, attempt.ipRes.count
+	if lockout > 0 {
+		log.Printf("Locked logins from %s for %s after %d failed attempts", attempt.ip, lockout, count)
+	}
+}
+
+// completeLogin issues the access and refresh tokens once every factor has
+// been checked, and only then forgets the account's failed attempts.
+// Logging in restores an account that is pending deletion, unless a
+// moderator scheduled the deletion.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User, deviceName string) {
+	type response struct {
+		User
+		Token             string `json:"token"`
+		RefreshToken      string `json:"refresh_token"`
+		DeletionCancelled bool   `json:"deletion_cancelled,omitempty"`
+	}
+
+	cfg.accountLogins.reset(loginKey(user))
+
+	var err error
+	deletionCancelled := false
+	if user.PendingDeletion() {
+		user, err = cfg.DB.CancelUserDeletion(user.ID)
+		if errors.Is(err, database.ErrDeletionNotCancellable) {
+			respondWithError(w, http.StatusForbidden, "Account is scheduled for deletion")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't cancel account deletion")
+			return
+		}
+		deletionCancelled = true
+	}
+
 	refreshToken, err := auth.MakeJWT(
 		user.ID,
-		cfg.jwtSecret,
-		time.Hour*24*30*6,
+		cfg.keyring,
+		refreshTokenTTL,
 		auth.TokenTypeRefresh,
 	)
 	if err != nil {
@@ -61,13 +200,27 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	family, err := cfg.DB.CreateTokenFamily(
+		user.ID,
+		auth.HashToken(refreshToken),
+		time.Now().UTC().Add(refreshTokenTTL),
+		sessionClient(r, deviceName),
+	)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create session")
+		return
+	}
+
+	accessToken, err := auth.MakeAccessToken(user.ID, family.ID, cfg.keyring, time.Hour)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT")
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			ID:          user.ID,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
-		Token:        accessToken,
-		RefreshToken: refreshToken,
+		User:              userFromDB(user),
+		Token:             accessToken,
+		RefreshToken:      refreshToken,
+		DeletionCancelled: deletionCancelled,
 	})
 }
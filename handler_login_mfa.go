@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+// handlerLoginMFA completes a login on an account with two-factor
+// authentication, exchanging the challenge token from handlerLogin and a
+// code for the usual token pair.
+func (cfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+		DeviceName   string `json:"device_name"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	claims, err := auth.ParseToken(params.MFAToken, cfg.keyring, auth.TokenTypeMFAChallenge)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+	if cfg.mfaAttempts.count(claims.ID) >= maxMFAAttempts {
+		respondWithError(w, http.StatusUnauthorized, "MFA token is no longer valid, log in again")
+		return
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse user ID")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(userID)
+	if err != nil || !user.MFAEnabled() {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+	now := time.Now().UTC()
+	if user.EffectiveState(now) == database.AccountStateSuspended {
+		respondWithError(w, http.StatusForbidden, "Account is suspended")
+		return
+	}
+
+	// Wrong codes count towards the same lockouts as wrong passwords, so
+	// fresh challenges can't be used to keep guessing.
+	ip := clientIP(r)
+	attempt, ok := cfg.beginLoginAttempt(w, loginKey(user), ip, now)
+	if !ok {
+		return
+	}
+
+	ok, err = cfg.checkSecondFactor(user, params.Code, params.RecoveryCode)
+	if err != nil {
+		cfg.releaseLoginAttempt(attempt)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check code")
+		return
+	}
+	if !ok {
+		cfg.mfaAttempts.fail(claims.ID, claims.ExpiresAt.Time)
+		cfg.recordLoginFailure(attempt, user)
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+	cfg.releaseLoginAttempt(attempt)
+
+	// A challenge is good for one login.
+	cfg.mfaAttempts.exhaust(claims.ID, maxMFAAttempts, claims.ExpiresAt.Time)
+
+	cfg.completeLogin(w, r, user, params.DeviceName)
+}
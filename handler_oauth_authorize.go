@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+// handlerOAuthAuthorizeGet validates an authorization request for the
+// consent screen, which the first-party app renders for the signed-in user.
+func (cfg *apiConfig) handlerOAuthAuthorizeGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		ClientID        string   `json:"client_id"`
+		ClientName      string   `json:"client_name"`
+		RedirectURI     string   `json:"redirect_uri"`
+		Scopes          []string `json:"scopes"`
+		ConsentRequired bool     `json:"consent_required"`
+	}
+
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	query := r.URL.Query()
+	req, authErr := cfg.parseAuthorizationRequest(
+		query.Get("response_type"),
+		query.Get("client_id"),
+		query.Get("redirect_uri"),
+		query.Get("scope"),
+		query.Get("state"),
+		query.Get("code_challenge"),
+		query.Get("code_challenge_method"),
+	)
+	if authErr != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, authErr.code, authErr.description)
+		return
+	}
+
+	consented, err := cfg.DB.HasOAuthConsent(userID, req.Client.ID, scopeStrings(req.Scopes))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check consent")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		ClientID:        req.Client.ID,
+		ClientName:      req.Client.Name,
+		RedirectURI:     req.RedirectURI,
+		Scopes:          scopeStrings(req.Scopes),
+		ConsentRequired: !consented,
+	})
+}
+
+// handlerOAuthAuthorizePost records the user's decision and returns where
+// to send the browser: back to the client with either a code or an error.
+func (cfg *apiConfig) handlerOAuthAuthorizePost(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ResponseType        string `json:"response_type"`
+		ClientID            string `json:"client_id"`
+		RedirectURI         string `json:"redirect_uri"`
+		Scope               string `json:"scope"`
+		State               string `json:"state"`
+		CodeChallenge       string `json:"code_challenge"`
+		CodeChallengeMethod string `json:"code_challenge_method"`
+		Approve             bool   `json:"approve"`
+	}
+	type response struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	req, authErr := cfg.parseAuthorizationRequest(
+		params.ResponseType,
+		params.ClientID,
+		params.RedirectURI,
+		params.Scope,
+		params.State,
+		params.CodeChallenge,
+		params.CodeChallengeMethod,
+	)
+	if authErr != nil && !authErr.redirect {
+		respondWithOAuthError(w, http.StatusBadRequest, authErr.code, authErr.description)
+		return
+	}
+	if authErr != nil {
+		respondWithJSON(w, http.StatusOK, response{
+			RedirectTo: req.redirectURL(url.Values{
+				"error":             {authErr.code},
+				"error_description": {authErr.description},
+			}),
+		})
+		return
+	}
+
+	if !params.Approve {
+		respondWithJSON(w, http.StatusOK, response{
+			RedirectTo: req.redirectURL(url.Values{
+				"error":             {"access_denied"},
+				"error_description": {"The user denied the request"},
+			}),
+		})
+		return
+	}
+
+	scopes := scopeStrings(req.Scopes)
+	err = cfg.DB.GrantOAuthConsent(userID, req.Client.ID, scopes)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record consent")
+		return
+	}
+
+	code, err := auth.MakeRandomToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create authorization code")
+		return
+	}
+
+	err = cfg.DB.CreateAuthorizationCode(database.AuthorizationCode{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      req.Client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().UTC().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create authorization code")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		RedirectTo: req.redirectURL(url.Values{"code": {code}}),
+	})
+}
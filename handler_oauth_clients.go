@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+	"github.com/nt2311-vn/Chirpy/internal/validation"
+)
+
+// maxRedirectURIs caps how many redirect URIs a client can register.
+const maxRedirectURIs = 10
+
+type OAuthClient struct {
+	ID           string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func oauthClientFromDB(client database.OAuthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		Confidential: client.Confidential(),
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// handlerOAuthClientsCreate registers a third-party application. The
+// secret of a confidential client is only ever returned in this response.
+func (cfg *apiConfig) handlerOAuthClientsCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+	type response struct {
+		OAuthClient
+		ClientSecret string `json:"client_secret,omitempty"`
+	}
+
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	errs := validation.Errors{}
+	if params.Name == "" || len(params.Name) > 100 {
+		errs.Add("name", "must be between 1 and 100 characters")
+	}
+	if len(params.RedirectURIs) == 0 || len(params.RedirectURIs) > maxRedirectURIs {
+		errs.Add("redirect_uris", fmt.Sprintf("must list between 1 and %d URIs", maxRedirectURIs))
+	}
+	for _, uri := range params.RedirectURIs {
+		if !isValidRedirectURI(uri) {
+			errs.Add("redirect_uris", fmt.Sprintf("%q must be an https or loopback http URI without a fragment", uri))
+		}
+	}
+	if errs.Err() != nil {
+		respondWithFieldErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	secret := ""
+	secretHash := ""
+	if params.Confidential {
+		secret, err = auth.MakeRandomToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create client secret")
+			return
+		}
+		secretHash = auth.HashToken(secret)
+	}
+
+	client, err := cfg.DB.CreateOAuthClient(database.OAuthClient{
+		OwnerID:      userID,
+		Name:         params.Name,
+		RedirectURIs: params.RedirectURIs,
+		SecretHash:   secretHash,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create client")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response{
+		OAuthClient:  oauthClientFromDB(client),
+		ClientSecret: secret,
+	})
+}
+
+func (cfg *apiConfig) handlerOAuthClientsGet(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	dbClients, err := cfg.DB.GetOAuthClientsByOwner(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve clients")
+		return
+	}
+
+	clients := make([]OAuthClient, 0, len(dbClients))
+	for _, dbClient := range dbClients {
+		clients = append(clients, oauthClientFromDB(dbClient))
+	}
+
+	respondWithJSON(w, http.StatusOK, clients)
+}
+
+// handlerOAuthClientsDelete removes a client and revokes every session
+// users granted it.
+func (cfg *apiConfig) handlerOAuthClientsDelete(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	err := cfg.DB.DeleteOAuthClient(userID, r.PathValue("clientID"))
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find client")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete client")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+// handlerOAuthIntrospect is the RFC 7662 introspection endpoint. Clients
+// can only introspect tokens issued to them; anything else is reported as
+// inactive.
+func (cfg *apiConfig) handlerOAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Active    bool     `json:"active"`
+		Scope     string   `json:"scope,omitempty"`
+		ClientID  string   `json:"client_id,omitempty"`
+		Subject   string   `json:"sub,omitempty"`
+		TokenType string   `json:"token_type,omitempty"`
+		ExpiresAt int64    `json:"exp,omitempty"`
+		IssuedAt  int64    `json:"iat,omitempty"`
+		Issuer    string   `json:"iss,omitempty"`
+		Audience  []string `json:"aud,omitempty"`
+		JTI       string   `json:"jti,omitempty"`
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "Couldn't parse form")
+		return
+	}
+
+	client, err := cfg.authenticateClient(r)
+	if err != nil || !client.Confidential() {
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "Only confidential clients can introspect tokens")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	token := r.PostForm.Get("token")
+	claims, ok := cfg.parseClientToken(token, client)
+	if !ok {
+		respondWithJSON(w, http.StatusOK, response{Active: false})
+		return
+	}
+
+	isRevoked, err := cfg.DB.IsTokenRevoked(auth.HashToken(token))
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't check token")
+		return
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || isRevoked {
+		respondWithJSON(w, http.StatusOK, response{Active: false})
+		return
+	}
+	if _, ok := cfg.oauthUser(userID, claims.IssuedAt.Time); !ok {
+		respondWithJSON(w, http.StatusOK, response{Active: false})
+		return
+	}
+	if claims.TokenType == auth.TokenTypeAccess && !cfg.sessionActive(claims, userID) {
+		respondWithJSON(w, http.StatusOK, response{Active: false})
+		return
+	}
+
+	tokenType := ""
+	if claims.TokenType == auth.TokenTypeAccess {
+		tokenType = "Bearer"
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Subject:   claims.Subject,
+		TokenType: tokenType,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		IssuedAt:  claims.IssuedAt.Unix(),
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+		JTI:       claims.ID,
+	})
+}
+
+// handlerOAuthRevoke is the RFC 7009 revocation endpoint. Revoking a
+// refresh token ends the whole session; revoking an access token only that
+// token. Tokens that don't validate are ignored, as the RFC requires.
+func (cfg *apiConfig) handlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "Couldn't parse form")
+		return
+	}
+
+	client, err := cfg.authenticateClient(r)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "Couldn't authenticate client")
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	claims, ok := cfg.parseClientToken(token, client)
+	if !ok {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	userID, _ := strconv.Atoi(claims.Subject)
+
+	tokenHash := auth.HashToken(token)
+	err = cfg.DB.RevokeToken(tokenHash, userID, claims.ExpiresAt.Time)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "Couldn't revoke token")
+		return
+	}
+
+	if claims.TokenType == auth.TokenTypeOAuthRefresh {
+		err = cfg.DB.RevokeTokenFamily(tokenHash)
+		if err != nil {
+			respondWithOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "Couldn't revoke session")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// parseClientToken validates an access or refresh token issued to client.
+func (cfg *apiConfig) parseClientToken(token string, client database.OAuthClient) (auth.Claims, bool) {
+	for _, tokenType := range []auth.TokenType{auth.TokenTypeAccess, auth.TokenTypeOAuthRefresh} {
+		claims, err := auth.ParseToken(token, cfg.keyring, tokenType)
+		if err == nil {
+			return claims, claims.ClientID == client.ID
+		}
+	}
+	return auth.Claims{}, false
+}
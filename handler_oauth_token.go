@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+// handlerOAuthToken is the RFC 6749 token endpoint. It exchanges
+// authorization codes and rotates refresh tokens.
+func (cfg *apiConfig) handlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "Couldn't parse form")
+		return
+	}
+
+	client, err := cfg.authenticateClient(r)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "Couldn't authenticate client")
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		cfg.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		cfg.refreshOAuthToken(w, r, client)
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Only authorization_code and refresh_token grants are supported")
+	}
+}
+
+func (cfg *apiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OAuthClient) {
+	// The code is only spent once it is known to be this client's, so a
+	// leaked code can't be burnt by anyone else.
+	var refreshToken string
+	var scopes []auth.Scope
+	code, family, err := cfg.DB.RedeemAuthorizationCode(
+		auth.HashToken(r.PostForm.Get("code")),
+		time.Now().UTC(),
+		func(code database.AuthorizationCode, user database.User) (database.CodeExchange, error) {
+			if code.ClientID != client.ID {
+				return database.CodeExchange{}, grantError("Authorization code was issued to another client")
+			}
+			redirectURI := r.PostForm.Get("redirect_uri")
+			if redirectURI != "" && redirectURI != code.RedirectURI {
+				return database.CodeExchange{}, grantError("Redirect URI doesn't match the authorization request")
+			}
+			if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+				return database.CodeExchange{}, grantError("Code verifier doesn't match the code challenge")
+			}
+			if !oauthUserActive(user, time.Now().UTC()) {
+				return database.CodeExchange{}, grantError("User can no longer authorize clients")
+			}
+
+			var err error
+			scopes = scopesFromStrings(code.Scopes)
+			refreshToken, err = auth.MakeOAuthToken(user.ID, client.ID, "", scopes, cfg.keyring, refreshTokenTTL, auth.TokenTypeOAuthRefresh)
+			if err != nil {
+				return database.CodeExchange{}, err
+			}
+			return database.CodeExchange{
+				TokenHash: auth.HashToken(refreshToken),
+				ExpiresAt: time.Now().UTC().Add(refreshTokenTTL),
+				Client:    oauthSessionClient(r, client, code.Scopes),
+			}, nil
+		},
+	)
+	var grantErr grantError
+	if errors.As(err, &grantErr) {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", string(grantErr))
+		return
+	}
+	if errors.Is(err, database.ErrTokenReused) {
+		log.Printf("Authorization code reuse detected for client %s, revoking session", client.ID)
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code was already used")
+		return
+	}
+	if errors.Is(err, database.ErrTokenInvalid) {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid or expired")
+		return
+	}
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't redeem authorization code")
+		return
+	}
+
+	accessToken, err := auth.MakeOAuthToken(code.UserID, client.ID, family.ID, scopes, cfg.keyring, oauthAccessTokenTTL, auth.TokenTypeAccess)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't create tokens")
+		return
+	}
+
+	respondWithOAuthTokens(w, accessToken, refreshToken, scopes)
+}
+
+// grantError is why a grant was refused, sent as an invalid_grant error.
+type grantError string
+
+func (e grantError) Error() string {
+	return string(e)
+}
+
+// refreshOAuthToken rotates a client's refresh token. The client may ask
+// for a narrower scope for the new access token; the refresh token keeps
+// the scope originally granted.
+func (cfg *apiConfig) refreshOAuthToken(w http.ResponseWriter, r *http.Request, client database.OAuthClient) {
+	refreshToken := r.PostForm.Get("refresh_token")
+	claims, err := auth.ParseToken(refreshToken, cfg.keyring, auth.TokenTypeOAuthRefresh)
+	if err != nil || claims.ClientID != client.ID {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is invalid")
+		return
+	}
+
+	isRevoked, err := cfg.DB.IsTokenRevoked(auth.HashToken(refreshToken))
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't check session")
+		return
+	}
+	if isRevoked {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is revoked")
+		return
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is invalid")
+		return
+	}
+	user, ok := cfg.oauthUser(userID, claims.IssuedAt.Time)
+	if !ok {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is revoked")
+		return
+	}
+
+	granted := auth.ParseScope(claims.Scope)
+	scopes := granted
+	if requested := r.PostForm.Get("scope"); requested != "" {
+		scopes = auth.ParseScope(requested)
+		for _, scope := range scopes {
+			if !slices.Contains(granted, scope) {
+				respondWithOAuthError(w, http.StatusBadRequest, "invalid_scope", "Requested scope exceeds the scope granted")
+				return
+			}
+		}
+	}
+
+	newRefreshToken, err := auth.MakeOAuthToken(user.ID, client.ID, "", granted, cfg.keyring, refreshTokenTTL, auth.TokenTypeOAuthRefresh)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't create tokens")
+		return
+	}
+
+	rotated, err := cfg.DB.RotateRefreshToken(
+		auth.HashToken(refreshToken),
+		auth.HashToken(newRefreshToken),
+		user.ID,
+		false,
+		time.Now().UTC().Add(refreshTokenTTL),
+		oauthSessionClient(r, client, scopeStrings(granted)),
+	)
+	if errors.Is(err, database.ErrTokenReused) {
+		log.Printf("Refresh token reuse detected for user %d and client %s, revoking session", user.ID, client.ID)
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is revoked")
+		return
+	}
+	if errors.Is(err, database.ErrTokenInvalid) {
+		respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is revoked")
+		return
+	}
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't rotate refresh token")
+		return
+	}
+
+	accessToken, err := auth.MakeOAuthToken(user.ID, client.ID, rotated.FamilyID, scopes, cfg.keyring, oauthAccessTokenTTL, auth.TokenTypeAccess)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "Couldn't create tokens")
+		return
+	}
+
+	respondWithOAuthTokens(w, accessToken, newRefreshToken, scopes)
+}
+
+// oauthUser returns the user a client acts for, unless they can no longer
+// be acted for: gone, suspended, leaving, or signed out everywhere since
+// issuedAt.
+func (cfg *apiConfig) oauthUser(userID int, issuedAt time.Time) (database.User, bool) {
+	user, err := cfg.DB.GetUser(userID)
+	if err != nil || !oauthUserActive(user, issuedAt) {
+		return database.User{}, false
+	}
+	return user, true
+}
+
+// oauthUserActive is oauthUser for a user already at hand.
+func oauthUserActive(user database.User, issuedAt time.Time) bool {
+	if user.TokenRevoked(issuedAt) || user.PendingDeletion() {
+		return false
+	}
+	return user.EffectiveState(time.Now().UTC()) != database.AccountStateSuspended
+}
+
+func oauthSessionClient(r *http.Request, client database.OAuthClient, scopes []string) database.SessionClient {
+	session := sessionClient(r, client.Name)
+	session.ClientID = client.ID
+	session.Scopes = scopes
+	return session
+}
+
+func respondWithOAuthTokens(w http.ResponseWriter, accessToken, refreshToken string, scopes []auth.Scope) {
+	type response struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, response{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        auth.FormatScope(scopes),
+	})
+}
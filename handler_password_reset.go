@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+	"github.com/nt2311-vn/Chirpy/internal/mail"
+	"github.com/nt2311-vn/Chirpy/internal/validation"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+func (cfg *apiConfig) handlerPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+	type response struct {
+		Message string `json:"message"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	// The response is the same whether or not the account exists, so this
+	// endpoint can't be used to discover registered emails.
+	accepted := response{
+		Message: "If an account exists for that email, a reset link has been sent",
+	}
+
+	user, err := cfg.DB.GetUserByEmail(normalizeEmailField(validation.Errors{}, "email", params.Email))
+	if err != nil {
+		respondWithJSON(w, http.StatusAccepted, accepted)
+		return
+	}
+
+	token, err := auth.MakeRandomToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create reset token")
+		return
+	}
+
+	_, err = cfg.DB.CreatePasswordReset(user.ID, auth.HashToken(token), time.Now().UTC().Add(passwordResetTTL))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create reset token")
+		return
+	}
+
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf(
+			"Reset your password by opening the link below within 30 minutes:\n\n%s/app/reset-password?token=%s\n\nIf you didn't ask for this, you can ignore this email.",
+			cfg.publicURL,
+			url.QueryEscape(token),
+		),
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := cfg.mailer.Send(ctx, msg)
+		if err != nil {
+			log.Printf("Couldn't send password reset email to user %d: %s", user.ID, err)
+		}
+	}()
+
+	respondWithJSON(w, http.StatusAccepted, accepted)
+}
+
+func (cfg *apiConfig) handlerPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	// The token is only spent once the new password is known to be
+	// acceptable, so a rejected password can be corrected and retried.
+	tokenHash := auth.HashToken(params.Token)
+	reset, err := cfg.DB.GetPasswordReset(tokenHash, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, database.ErrTokenInvalid) {
+			respondWithError(w, http.StatusUnauthorized, "Invalid or expired reset token")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check reset token")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(reset.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired reset token")
+		return
+	}
+
+	errs := validation.Errors{}
+	err = cfg.checkPasswordField(errs, "password", params.Password, user.Email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check password")
+		return
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	hashedPassword, err := cfg.passwords.Hash(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password")
+		return
+	}
+
+	err = cfg.DB.ResetPassword(tokenHash, hashedPassword, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, database.ErrTokenInvalid) {
+			respondWithError(w, http.StatusUnauthorized, "Invalid or expired reset token")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reset password")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
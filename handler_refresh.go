@@ -1,14 +1,24 @@
 package main
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
 )
 
+// refreshTokenTTL is how long a refresh token stays valid. Each use
+// rotates it, so the lifetime restarts on every refresh.
+const refreshTokenTTL = time.Hour * 24 * 30 * 6
+
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -17,7 +27,7 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	isRevoked, err := cfg.DB.IsTokenRevoked(refreshToken)
+	isRevoked, err := cfg.DB.IsTokenRevoked(auth.HashToken(refreshToken))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't check session")
 		return
@@ -27,14 +37,77 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, err := auth.RefreshToken(refreshToken, cfg.jwtSecret)
+	claims, err := auth.ParseToken(refreshToken, cfg.keyring, auth.TokenTypeRefresh)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
 		return
 	}
 
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse user ID")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find user")
+		return
+	}
+
+	issuedAt, err := auth.IssuedAt(refreshToken)
+	if err != nil || user.TokenRevoked(issuedAt) || user.PendingDeletion() {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token is revoked")
+		return
+	}
+	if user.EffectiveState(time.Now().UTC()) == database.AccountStateSuspended {
+		respondWithError(w, http.StatusForbidden, "Account is suspended")
+		return
+	}
+
+	newRefreshToken, err := auth.MakeJWT(
+		user.ID,
+		cfg.keyring,
+		refreshTokenTTL,
+		auth.TokenTypeRefresh,
+	)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh JWT")
+		return
+	}
+
+	rotated, err := cfg.DB.RotateRefreshToken(
+		auth.HashToken(refreshToken),
+		auth.HashToken(newRefreshToken),
+		user.ID,
+		// Refresh tokens issued before rotation existed have no jti.
+		claims.ID == "",
+		time.Now().UTC().Add(refreshTokenTTL),
+		sessionClient(r, ""),
+	)
+	if errors.Is(err, database.ErrTokenReused) {
+		log.Printf("Refresh token reuse detected for user %d, revoking session", user.ID)
+		respondWithError(w, http.StatusUnauthorized, "Refresh token is revoked")
+		return
+	}
+	if errors.Is(err, database.ErrTokenInvalid) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token is revoked")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rotate refresh token")
+		return
+	}
+
+	accessToken, err := auth.MakeAccessToken(user.ID, rotated.FamilyID, cfg.keyring, time.Hour)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT")
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
 	})
 }
 
@@ -45,7 +118,33 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = cfg.DB.RevokeToken(refreshToken)
+	// A token that doesn't validate can't be used anyway, so there is
+	// nothing to record.
+	subject, err := auth.ValidateRefreshToken(refreshToken, cfg.keyring)
+	if err != nil {
+		respondWithJSON(w, http.StatusOK, struct{}{})
+		return
+	}
+	userID, err := strconv.Atoi(subject)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse user ID")
+		return
+	}
+
+	expiresAt, err := auth.ExpiresAt(refreshToken)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse JWT")
+		return
+	}
+
+	tokenHash := auth.HashToken(refreshToken)
+	err = cfg.DB.RevokeToken(tokenHash, userID, expiresAt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session")
+		return
+	}
+
+	err = cfg.DB.RevokeTokenFamily(tokenHash)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session")
 		return
@@ -53,3 +152,21 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 
 	respondWithJSON(w, http.StatusOK, struct{}{})
 }
+
+// sweepExpiredTokens periodically drops revocations and refresh token
+// records once the tokens they describe have expired anyway.
+func (cfg *apiConfig) sweepExpiredTokens(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := cfg.DB.PurgeExpiredTokens(time.Now().UTC())
+		if err != nil {
+			log.Printf("Couldn't purge expired tokens: %s", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Purged %d expired token records", purged)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+const maxReportDetailsLength = 1000
+
+type Report struct {
+	ID         int       `json:"id"`
+	TargetType string    `json:"target_type"`
+	TargetID   int       `json:"target_id"`
+	Reason     string    `json:"reason"`
+	Details    string    `json:"details"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerChirpReportsCreate(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	chirp, err := cfg.DB.GetChirp(chirpID)
+	if err != nil || chirp.Hidden {
+		respondWithError(w, http.StatusNotFound, "Couldn't find chirp")
+		return
+	}
+
+	cfg.createReport(w, r, database.ReportTargetChirp, chirpID)
+}
+
+func (cfg *apiConfig) handlerUserReportsCreate(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	_, err = cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user")
+		return
+	}
+
+	cfg.createReport(w, r, database.ReportTargetUser, userID)
+}
+
+func (cfg *apiConfig) createReport(w http.ResponseWriter, r *http.Request, targetType database.ReportTarget, targetID int) {
+	type parameters struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	reporterID := auth.MustPrincipal(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	reason := database.ReportReason(params.Reason)
+	if !database.IsValidReportReason(reason) {
+		respondWithError(w, http.StatusBadRequest, "Invalid report reason")
+		return
+	}
+
+	if len(params.Details) > maxReportDetailsLength {
+		respondWithError(w, http.StatusBadRequest, "Report details are too long")
+		return
+	}
+
+	report, err := cfg.DB.CreateReport(reporterID, targetType, targetID, reason, params.Details)
+	if err != nil {
+		if errors.Is(err, database.ErrAlreadyExists) {
+			respondWithError(w, http.StatusConflict, "Report already filed")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create report")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, reportFromDB(report))
+}
+
+func reportFromDB(report database.Report) Report {
+	return Report{
+		ID:         report.ID,
+		TargetType: string(report.TargetType),
+		TargetID:   report.TargetID,
+		Reason:     string(report.Reason),
+		Details:    report.Details,
+		Status:     string(report.Status),
+		CreatedAt:  report.CreatedAt,
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+type Session struct {
+	ID         string     `json:"id"`
+	DeviceName string     `json:"device_name"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func sessionFromDB(family database.TokenFamily) Session {
+	session := Session{
+		ID:         family.ID,
+		DeviceName: family.DeviceName,
+		IP:         family.IP,
+		UserAgent:  family.UserAgent,
+		CreatedAt:  family.CreatedAt,
+		LastUsedAt: family.LastUsedAt,
+		ExpiresAt:  family.ExpiresAt,
+	}
+	if !family.RevokedAt.IsZero() {
+		session.RevokedAt = &family.RevokedAt
+	}
+	return session
+}
+
+// clientIP returns the address of the direct peer. Forwarding headers are
+// ignored because they are trivially spoofed.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// sessionClient describes the device making the request. The device name
+// falls back to the user agent when the client doesn't send one.
+func sessionClient(r *http.Request, deviceName string) database.SessionClient {
+	const maxDeviceNameLength = 100
+
+	userAgent := r.UserAgent()
+	if deviceName == "" {
+		deviceName = userAgent
+	}
+	if len(deviceName) > maxDeviceNameLength {
+		deviceName = deviceName[:maxDeviceNameLength]
+	}
+
+	return database.SessionClient{
+		DeviceName: deviceName,
+		IP:         clientIP(r),
+		UserAgent:  userAgent,
+	}
+}
+
+func (cfg *apiConfig) handlerSessionsGet(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	dbSessions, err := cfg.DB.GetSessions(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve sessions")
+		return
+	}
+
+	sessions := make([]Session, 0, len(dbSessions))
+	for _, dbSession := range dbSessions {
+		sessions = append(sessions, sessionFromDB(dbSession))
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+func (cfg *apiConfig) handlerSessionsDelete(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	err := cfg.DB.RevokeSession(userID, r.PathValue("sessionID"))
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find session")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerSessionsDeleteAll logs the user out everywhere, including the
+// device making the request.
+func (cfg *apiConfig) handlerSessionsDeleteAll(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	err := cfg.DB.RevokeAllSessions(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
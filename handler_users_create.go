@@ -5,8 +5,8 @@ import (
 	"errors"
 	"net/http"
 
-	"github.com/nt2311-vn/Chirpy/internal/auth"
 	"github.com/nt2311-vn/Chirpy/internal/database"
+	"github.com/nt2311-vn/Chirpy/internal/validation"
 )
 
 type User struct {
@@ -14,6 +14,27 @@ type User struct {
 	Email       string `json:"email"`
 	Password    string `json:"-"`
 	IsChirpyRed bool   `json:"is_chirpy_red"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarURL   string `json:"avatar_url"`
+	// EmailVerified is false until the current email has been confirmed.
+	EmailVerified bool `json:"email_verified"`
+	MFAEnabled    bool `json:"mfa_enabled"`
+}
+
+func userFromDB(user database.User) User {
+	return User{
+		ID:            user.ID,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		Handle:        user.Handle,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarURL:     user.AvatarURL,
+		EmailVerified: user.EmailVerified,
+		MFAEnabled:    user.MFAEnabled(),
+	}
 }
 
 func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request) {
@@ -33,16 +54,28 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	errs := validation.Errors{}
+	email := normalizeEmailField(errs, "email", params.Email)
+	err = cfg.checkPasswordField(errs, "password", params.Password, email)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check password")
+		return
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	hashedPassword, err := cfg.passwords.Hash(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password")
 		return
 	}
 
-	user, err := cfg.DB.CreateUser(params.Email, hashedPassword)
+	user, err := cfg.DB.CreateUser(email, hashedPassword)
 	if err != nil {
 		if errors.Is(err, database.ErrAlreadyExists) {
-			respondWithError(w, http.StatusConflict, "User already exists")
+			respondWithFieldErrors(w, http.StatusConflict, validation.Errors{"email": "is already in use"})
 			return
 		}
 
@@ -50,10 +83,13 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	err = cfg.sendVerificationEmail(user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email")
+		return
+	}
+
 	respondWithJSON(w, http.StatusCreated, response{
-		User: User{
-			ID:    user.ID,
-			Email: user.Email,
-		},
+		User: userFromDB(user),
 	})
 }
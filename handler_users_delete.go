@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+// accountDeletionGracePeriod is how long a deleted account can still be
+// restored by logging in. Deletions scheduled by a moderator can't be.
+const accountDeletionGracePeriod = 14 * 24 * time.Hour
+
+func (cfg *apiConfig) handlerUsersDelete(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+	type response struct {
+		DeletionScheduledFor time.Time `json:"deletion_scheduled_for"`
+	}
+
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user")
+		return
+	}
+
+	// Wrong passwords count towards the login lockouts, as they do
+	// wherever else a logged in user has to confirm theirs.
+	now := time.Now().UTC()
+	ip := clientIP(r)
+	attempt, ok := cfg.beginLoginAttempt(w, loginKey(user), ip, now)
+	if !ok {
+		return
+	}
+
+	err = cfg.passwords.Check(params.Password, user.HashedPassword)
+	if err != nil {
+		cfg.recordLoginFailure(attempt, user)
+		respondWithError(w, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+	cfg.releaseLoginAttempt(attempt)
+
+	user, err = cfg.DB.ScheduleUserDeletion(user.ID, now.Add(accountDeletionGracePeriod), "")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, response{
+		DeletionScheduledFor: user.DeletionScheduledFor,
+	})
+}
+
+func (cfg *apiConfig) handlerAdminUsersDelete(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Immediate bool   `json:"immediate"`
+		Note      string `json:"note"`
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	if params.Immediate {
+		err = cfg.DB.DeleteUser(userID)
+	} else {
+		_, err = cfg.DB.ScheduleUserDeletion(userID, time.Now().UTC().Add(accountDeletionGracePeriod), moderator(r))
+	}
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user")
+		return
+	}
+
+	_, err = cfg.DB.LogModerationAction(database.ModerationAction{
+		Moderator:  moderator(r),
+		Action:     database.ModerationActionDeleteUser,
+		TargetType: database.ReportTargetUser,
+		TargetID:   userID,
+		Note:       params.Note,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record action")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeDeletedUsers removes accounts whose deletion grace period has ended,
+// checking every interval.
+func (cfg *apiConfig) purgeDeletedUsers(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := cfg.DB.PurgeScheduledDeletions(time.Now().UTC())
+		if err != nil {
+			log.Printf("Couldn't purge deleted users: %s", err)
+			continue
+		}
+		if len(purged) > 0 {
+			log.Printf("Purged %d deleted users", len(purged))
+		}
+	}
+}
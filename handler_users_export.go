@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/hmac"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+type DataExport struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+func (cfg *apiConfig) dataExportFromDB(export database.DataExport) DataExport {
+	resp := DataExport{
+		ID:        export.ID,
+		Status:    string(export.Status),
+		CreatedAt: export.CreatedAt,
+	}
+	if export.Status == database.ExportStatusReady {
+		resp.ExpiresAt = &export.ExpiresAt
+		resp.DownloadURL = cfg.exportDownloadURL(export)
+	}
+	return resp
+}
+
+func (cfg *apiConfig) handlerUsersExportCreate(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	export, err := cfg.DB.CreateExport(userID)
+	if err != nil {
+		if errors.Is(err, database.ErrAlreadyExists) {
+			respondWithError(w, http.StatusConflict, "An export is already in progress")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create export")
+		return
+	}
+
+	go cfg.buildExport(export)
+
+	respondWithJSON(w, http.StatusAccepted, cfg.dataExportFromDB(export))
+}
+
+func (cfg *apiConfig) handlerUsersExportGet(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	export, err := cfg.DB.GetExport(r.PathValue("exportID"))
+	if err != nil || export.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't find export")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.dataExportFromDB(export))
+}
+
+func (cfg *apiConfig) handlerUsersExportDownload(w http.ResponseWriter, r *http.Request) {
+	exportID := r.PathValue("exportID")
+
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, "Invalid download link")
+		return
+	}
+	signature := r.URL.Query().Get("signature")
+	if !hmac.Equal([]byte(signature), []byte(cfg.exportSignature(exportID, expires))) {
+		respondWithError(w, http.StatusForbidden, "Invalid download link")
+		return
+	}
+	if time.Now().UTC().After(time.Unix(expires, 0)) {
+		respondWithError(w, http.StatusGone, "Download link has expired")
+		return
+	}
+
+	export, err := cfg.DB.GetExport(exportID)
+	if err != nil || export.Status != database.ExportStatusReady {
+		respondWithError(w, http.StatusNotFound, "Couldn't find export")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.zip"`)
+	http.ServeFile(w, r, cfg.exportPath(export.ID))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+type Profile struct {
+	ID          int    `json:"id"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarURL   string `json:"avatar_url"`
+	IsChirpyRed bool   `json:"is_chirpy_red"`
+}
+
+func (cfg *apiConfig) handlerUsersGet(w http.ResponseWriter, r *http.Request) {
+	idOrHandle := r.PathValue("idOrHandle")
+
+	var user database.User
+	var err error
+	if userID, convErr := strconv.Atoi(idOrHandle); convErr == nil {
+		user, err = cfg.DB.GetUser(userID)
+	} else {
+		user, err = cfg.DB.GetUserByHandle(strings.TrimPrefix(idOrHandle, "@"))
+	}
+	if err != nil || user.PendingDeletion() {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, profileFromDB(user))
+}
+
+// profileFromDB builds the public view of a user, which must never include
+// the email or password hash.
+func profileFromDB(user database.User) Profile {
+	return Profile{
+		ID:          user.ID,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		IsChirpyRed: user.IsChirpyRed,
+	}
+}
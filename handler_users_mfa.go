@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+// handlerUsersMFAEnroll starts enrolling an authenticator. Two-factor
+// authentication isn't enforced until handlerUsersMFAConfirm sees a valid
+// code.
+func (cfg *apiConfig) handlerUsersMFAEnroll(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	user, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user")
+		return
+	}
+	if user.MFAEnabled() {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create secret")
+		return
+	}
+	sealed, err := cfg.sealMFASecret(secret)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create secret")
+		return
+	}
+
+	err = cfg.DB.SetPendingMFASecret(user.ID, sealed)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save secret")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, "Chirpy", user.Email),
+	})
+}
+
+// handlerUsersMFAConfirm enables two-factor authentication once the user
+// proves their authenticator works. The recovery codes are only ever shown
+// in this response.
+func (cfg *apiConfig) handlerUsersMFAConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user")
+		return
+	}
+	if user.MFAPendingSecret == "" {
+		respondWithError(w, http.StatusConflict, "No enrollment in progress")
+		return
+	}
+
+	secret, err := cfg.openMFASecret(user.MFAPendingSecret)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read secret")
+		return
+	}
+	step, ok := auth.ValidateTOTP(secret, params.Code, time.Now().UTC())
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+
+	codes, err := auth.MakeRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes")
+		return
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, auth.HashToken(code))
+	}
+
+	err = cfg.DB.EnableMFA(user.ID, step, hashes)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusConflict, "No enrollment in progress")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		RecoveryCodes: codes,
+	})
+}
+
+// handlerUsersMFADisable turns two-factor authentication off. It asks for
+// both the password and a code so a stolen access token isn't enough.
+func (cfg *apiConfig) handlerUsersMFADisable(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user")
+		return
+	}
+	if !user.MFAEnabled() {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is not enabled")
+		return
+	}
+
+	// Both checks are rate limited like a login, or a stolen access token
+	// could be used to guess them.
+	now := time.Now().UTC()
+	ip := clientIP(r)
+	attempt, ok := cfg.beginLoginAttempt(w, loginKey(user), ip, now)
+	if !ok {
+		return
+	}
+
+	err = cfg.passwords.Check(params.Password, user.HashedPassword)
+	if err != nil {
+		cfg.recordLoginFailure(attempt, user)
+		respondWithError(w, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+
+	ok, err = cfg.checkSecondFactor(user, params.Code, params.RecoveryCode)
+	if err != nil {
+		cfg.releaseLoginAttempt(attempt)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check code")
+		return
+	}
+	if !ok {
+		cfg.recordLoginFailure(attempt, user)
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+	cfg.releaseLoginAttempt(attempt)
+	cfg.accountLogins.reset(loginKey(user))
+
+	err = cfg.DB.DisableMFA(user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
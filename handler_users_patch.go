@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+	"github.com/nt2311-vn/Chirpy/internal/validation"
+)
+
+// handlerUsersPatch applies a JSON Merge Patch (RFC 7396) to the
+// authenticated user. Omitted fields are left alone and null clears a
+// profile field. Changing the email or password requires current_password.
+func (cfg *apiConfig) handlerUsersPatch(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		User
+	}
+
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	patch := map[string]json.RawMessage{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&patch)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Patch must be a JSON object")
+		return
+	}
+
+	current, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user")
+		return
+	}
+
+	errs := validation.Errors{}
+	changes := profileChanges{}
+	var email, password, currentPassword *string
+	for key, value := range patch {
+		var target **string
+		nullable := true
+		switch key {
+		case "handle":
+			target = &changes.Handle
+		case "display_name":
+			target = &changes.DisplayName
+		case "bio":
+			target = &changes.Bio
+		case "avatar_url":
+			target = &changes.AvatarURL
+		case "email":
+			target, nullable = &email, false
+		case "password":
+			target, nullable = &password, false
+		case "current_password":
+			target, nullable = &currentPassword, false
+		default:
+			errs.Add(key, "is not a known field")
+			continue
+		}
+
+		str, err := mergePatchString(value, nullable)
+		if err != nil {
+			errs.Add(key, err.Error())
+			continue
+		}
+		*target = &str
+	}
+
+	newEmail := current.Email
+	if email != nil {
+		newEmail = normalizeEmailField(errs, "email", *email)
+	}
+	if password != nil {
+		err = cfg.checkPasswordField(errs, "password", *password, newEmail)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check password")
+			return
+		}
+	}
+	profile, profileChanged := applyProfileChanges(current, changes)
+	if profileChanged {
+		validateProfile(errs, profile)
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	newHash := current.HashedPassword
+	if email != nil || password != nil {
+		if !cfg.checkCurrentPassword(w, r, current, currentPassword) {
+			return
+		}
+
+		if password != nil {
+			newHash, err = cfg.passwords.Hash(*password)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't hash password")
+				return
+			}
+		}
+	}
+
+	user := current
+	if profileChanged || newEmail != current.Email || newHash != current.HashedPassword {
+		var ok bool
+		user, ok = cfg.updateAccount(w, current.ID, newEmail, newHash, profile)
+		if !ok {
+			return
+		}
+	}
+
+	if user.Email != current.Email {
+		err = cfg.sendVerificationEmail(user)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email")
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		User: userFromDB(user),
+	})
+}
+
+// checkCurrentPassword verifies the current password a user must give to
+// change their email or password. Wrong guesses count towards the login
+// lockouts, so a stolen access token can't be used to find the password.
+// It responds with an error and returns false if the password is missing
+// or wrong.
+func (cfg *apiConfig) checkCurrentPassword(w http.ResponseWriter, r *http.Request, user database.User, currentPassword *string) bool {
+	if currentPassword == nil || *currentPassword == "" {
+		respondWithFieldErrors(w, http.StatusUnauthorized, validation.Errors{
+			"current_password": "is required to change email or password",
+		})
+		return false
+	}
+
+	now := time.Now().UTC()
+	ip := clientIP(r)
+	attempt, ok := cfg.beginLoginAttempt(w, loginKey(user), ip, now)
+	if !ok {
+		return false
+	}
+
+	err := cfg.passwords.Check(*currentPassword, user.HashedPassword)
+	if err != nil {
+		cfg.recordLoginFailure(attempt, user)
+		respondWithFieldErrors(w, http.StatusUnauthorized, validation.Errors{
+			"current_password": "is incorrect",
+		})
+		return false
+	}
+	cfg.releaseLoginAttempt(attempt)
+
+	return true
+}
+
+// mergePatchString decodes a merge patch member that must be a string. A
+// null value means "remove", which is reported as the empty string when
+// nullable.
+func mergePatchString(value json.RawMessage, nullable bool) (string, error) {
+	if string(value) == "null" {
+		if !nullable {
+			return "", errors.New("can't be null")
+		}
+		return "", nil
+	}
+
+	str := ""
+	err := json.Unmarshal(value, &str)
+	if err != nil {
+		return "", errors.New("must be a string")
+	}
+	return str, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerUsersBlock(w http.ResponseWriter, r *http.Request) {
+	cfg.updateRelation(w, r, func(userID, targetID int) error {
+		_, err := cfg.DB.BlockUser(userID, targetID)
+		return err
+	})
+}
+
+func (cfg *apiConfig) handlerUsersUnblock(w http.ResponseWriter, r *http.Request) {
+	cfg.updateRelation(w, r, cfg.DB.UnblockUser)
+}
+
+func (cfg *apiConfig) handlerUsersMute(w http.ResponseWriter, r *http.Request) {
+	cfg.updateRelation(w, r, func(userID, targetID int) error {
+		_, err := cfg.DB.MuteUser(userID, targetID)
+		return err
+	})
+}
+
+func (cfg *apiConfig) handlerUsersUnmute(w http.ResponseWriter, r *http.Request) {
+	cfg.updateRelation(w, r, cfg.DB.UnmuteUser)
+}
+
+func (cfg *apiConfig) updateRelation(w http.ResponseWriter, r *http.Request, apply func(userID, targetID int) error) {
+	targetID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	if userID == targetID {
+		respondWithError(w, http.StatusBadRequest, "Cannot block or mute yourself")
+		return
+	}
+
+	err = apply(userID, targetID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusNotFound, "Couldn't find user")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
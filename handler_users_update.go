@@ -2,62 +2,222 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/rivo/uniseg"
 
 	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+	"github.com/nt2311-vn/Chirpy/internal/validation"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarURLLength   = 500
 )
 
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,20}$`)
+
+var reservedHandles = map[string]struct{}{
+	"admin":     {},
+	"api":       {},
+	"app":       {},
+	"chirpy":    {},
+	"export":    {},
+	"help":      {},
+	"login":     {},
+	"me":        {},
+	"moderator": {},
+	"root":      {},
+	"settings":  {},
+	"support":   {},
+	"system":    {},
+}
+
 func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password    string  `json:"password"`
+		Email       string  `json:"email"`
+		Handle      *string `json:"handle"`
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		AvatarURL   *string `json:"avatar_url"`
 	}
 	type response struct {
 		User
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	userIDInt := auth.MustPrincipal(r.Context()).UserID
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
 		return
 	}
-	subject, err := auth.ValidateJWT(token, cfg.jwtSecret)
+
+	current, err := cfg.DB.GetUser(userIDInt)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
+		respondWithError(w, http.StatusNotFound, "Couldn't find user")
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
+	errs := validation.Errors{}
+	email := normalizeEmailField(errs, "email", params.Email)
+	err = cfg.checkPasswordField(errs, "password", params.Password, email)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check password")
+		return
+	}
+	profile, profileChanged := applyProfileChanges(current, profileChanges{
+		Handle:      params.Handle,
+		DisplayName: params.DisplayName,
+		Bio:         params.Bio,
+		AvatarURL:   params.AvatarURL,
+	})
+	if profileChanged {
+		validateProfile(errs, profile)
+	}
+	if len(errs) > 0 {
+		respondWithFieldErrors(w, http.StatusBadRequest, errs)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	hashedPassword, err := cfg.passwords.Hash(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password")
 		return
 	}
 
-	userIDInt, err := strconv.Atoi(subject)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't parse user ID")
+	user, ok := cfg.updateAccount(w, current.ID, email, hashedPassword, profile)
+	if !ok {
 		return
 	}
 
-	user, err := cfg.DB.UpdateUser(userIDInt, params.Email, hashedPassword)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create user")
-		return
+	if user.Email != current.Email {
+		err = cfg.sendVerificationEmail(user)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email")
+			return
+		}
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			ID:    user.ID,
-			Email: user.Email,
-		},
+		User: userFromDB(user),
+	})
+}
+
+// profileChanges holds the profile fields a request sets. A nil field is
+// left unchanged.
+type profileChanges struct {
+	Handle      *string
+	DisplayName *string
+	Bio         *string
+	AvatarURL   *string
+}
+
+// applyProfileChanges returns the user's profile with changes applied and
+// whether it differs from the current one.
+func applyProfileChanges(current database.User, changes profileChanges) (database.Profile, bool) {
+	profile := database.Profile{
+		Handle:      current.Handle,
+		DisplayName: current.DisplayName,
+		Bio:         current.Bio,
+		AvatarURL:   current.AvatarURL,
+	}
+	before := profile
+	if changes.Handle != nil {
+		profile.Handle = strings.TrimPrefix(strings.TrimSpace(*changes.Handle), "@")
+	}
+	if changes.DisplayName != nil {
+		profile.DisplayName = strings.TrimSpace(*changes.DisplayName)
+	}
+	if changes.Bio != nil {
+		profile.Bio = strings.TrimSpace(*changes.Bio)
+	}
+	if changes.AvatarURL != nil {
+		profile.AvatarURL = strings.TrimSpace(*changes.AvatarURL)
+	}
+
+	return profile, profile != before
+}
+
+// updateAccount saves validated credentials and profile together, so a
+// conflict on either leaves the user unchanged. It responds with an error
+// and returns false if the update failed.
+func (cfg *apiConfig) updateAccount(w http.ResponseWriter, userID int, email, hashedPassword string, profile database.Profile) (database.User, bool) {
+	user, err := cfg.DB.UpdateAccount(userID, email, hashedPassword, profile)
+	if errors.Is(err, database.ErrHandleTaken) {
+		respondWithFieldErrors(w, http.StatusConflict, validation.Errors{"handle": "is already taken"})
+		return database.User{}, false
+	}
+	if errors.Is(err, database.ErrEmailTaken) {
+		respondWithFieldErrors(w, http.StatusConflict, validation.Errors{"email": "is already in use"})
+		return database.User{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user")
+		return database.User{}, false
+	}
+
+	return user, true
+}
+
+func validateProfile(errs validation.Errors, profile database.Profile) {
+	if profile.Handle != "" {
+		err := validateHandle(profile.Handle)
+		if err != nil {
+			errs.Add("handle", err.Error())
+		}
+	}
+
+	if uniseg.GraphemeClusterCount(profile.DisplayName) > maxDisplayNameLength {
+		errs.Add("display_name", fmt.Sprintf("must be at most %d characters", maxDisplayNameLength))
+	}
+	if containsControl(profile.DisplayName) {
+		errs.Add("display_name", "must not contain control characters")
+	}
+	if uniseg.GraphemeClusterCount(profile.Bio) > maxBioLength {
+		errs.Add("bio", fmt.Sprintf("must be at most %d characters", maxBioLength))
+	}
+	if containsControl(profile.Bio) {
+		errs.Add("bio", "must not contain control characters")
+	}
+
+	if profile.AvatarURL != "" {
+		if len(profile.AvatarURL) > maxAvatarURLLength {
+			errs.Add("avatar_url", "is too long")
+		}
+		u, err := url.Parse(profile.AvatarURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.Add("avatar_url", "must be an http(s) URL")
+		}
+	}
+}
+
+func validateHandle(handle string) error {
+	if !handlePattern.MatchString(handle) {
+		return errors.New("must be 3 to 20 letters, digits or underscores")
+	}
+	if !strings.ContainsFunc(handle, unicode.IsLetter) {
+		return errors.New("must contain a letter")
+	}
+	if _, ok := reservedHandles[strings.ToLower(handle)]; ok {
+		return errors.New("is reserved")
+	}
+	return nil
+}
+
+func containsControl(s string) bool {
+	return strings.ContainsFunc(s, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n'
 	})
 }
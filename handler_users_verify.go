@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+	"github.com/nt2311-vn/Chirpy/internal/mail"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// sendVerificationEmail emails the user a link to confirm their current
+// address. Delivery happens in the background so a slow mail server
+// doesn't hold up the request.
+func (cfg *apiConfig) sendVerificationEmail(user database.User) error {
+	token, err := auth.MakeEmailVerificationToken(user.ID, user.Email, cfg.keyring, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf(
+			"Confirm this address by opening the link below within 24 hours:\n\n%s/app/verify?token=%s\n\nIf you didn't sign up for Chirpy, you can ignore this email.",
+			cfg.publicURL,
+			url.QueryEscape(token),
+		),
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := cfg.mailer.Send(ctx, msg)
+		if err != nil {
+			log.Printf("Couldn't send verification email to user %d: %s", user.ID, err)
+		}
+	}()
+
+	return nil
+}
+
+func (cfg *apiConfig) handlerUsersVerify(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+	type response struct {
+		User
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	userID, email, err := auth.ValidateEmailVerificationToken(params.Token, cfg.keyring)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid verification token")
+		return
+	}
+
+	user, err := cfg.DB.VerifyUserEmail(userID, email)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid verification token")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		User: userFromDB(user),
+	})
+}
+
+func (cfg *apiConfig) handlerUsersVerifyResend(w http.ResponseWriter, r *http.Request) {
+	userID := auth.MustPrincipal(r.Context()).UserID
+
+	user, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user")
+		return
+	}
+	if user.EmailVerified {
+		respondWithError(w, http.StatusConflict, "Email is already verified")
+		return
+	}
+
+	err = cfg.sendVerificationEmail(user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't send verification email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
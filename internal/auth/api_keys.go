@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix marks personal API keys so they can be told apart from JWTs
+// in a bearer header and spotted by secret scanners.
+const APIKeyPrefix = "chirpy_"
+
+// Scope -
+type Scope string
+
+const (
+	// ScopeChirpsRead -
+	ScopeChirpsRead Scope = "chirps:read"
+	// ScopeChirpsWrite -
+	ScopeChirpsWrite Scope = "chirps:write"
+	// ScopeAccount covers everything beyond reading and writing chirps:
+	// the profile, security settings, sessions, keys, blocks and reports.
+	// Only interactive logins hold it.
+	ScopeAccount Scope = "account"
+)
+
+// AccessTokenScopes are the scopes of an access token from a login.
+var AccessTokenScopes = []Scope{ScopeChirpsRead, ScopeChirpsWrite, ScopeAccount}
+
+// IsValidScope reports whether scope can be granted to an API key.
+func IsValidScope(scope Scope) bool {
+	switch scope {
+	case ScopeChirpsRead, ScopeChirpsWrite:
+		return true
+	}
+	return false
+}
+
+// MakeAPIKey returns a new key and its public ID. The key is shown to the
+// user once; only HashToken(key) should be stored.
+func MakeAPIKey() (id, key string, err error) {
+	b := make([]byte, 8)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+	id = hex.EncodeToString(b)
+
+	secret, err := MakeRandomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	return id, APIKeyPrefix + id + "_" + secret, nil
+}
+
+// ParseAPIKey returns the ID embedded in an API key.
+func ParseAPIKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	if !ok || id == "" || secret == "" {
+		return "", false
+	}
+	return id, true
+}
@@ -1,15 +1,16 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type TokenType string
@@ -19,124 +20,169 @@ const (
 	TokenTypeAccess TokenType = "chirpy-access"
 	// TokenTypeRefresh -
 	TokenTypeRefresh TokenType = "chirpy-refresh"
+	// TokenTypeEmailVerification -
+	TokenTypeEmailVerification TokenType = "chirpy-email-verification"
+	// TokenTypeMFAChallenge is issued after the password step of a login
+	// on an account with two-factor authentication.
+	TokenTypeMFAChallenge TokenType = "chirpy-mfa-challenge"
+	// TokenTypeOAuthRefresh is a refresh token held by an OAuth client. It
+	// is only accepted by the OAuth token endpoint.
+	TokenTypeOAuthRefresh TokenType = "chirpy-oauth-refresh"
 )
 
 // ErrNoAuthHeaderIncluded -
 var ErrNoAuthHeaderIncluded = errors.New("not auth header included in request")
 
-// HashPassword -
-func HashPassword(password string) (string, error) {
-	dat, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(dat), nil
-}
-
-// CheckPasswordHash -
-func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-}
-
 // MakeJWT -
 func MakeJWT(
 	userID int,
-	tokenSecret string,
+	keyring *Keyring,
 	expiresIn time.Duration,
 	tokenType TokenType,
 ) (string, error) {
-	signingKey := []byte(tokenSecret)
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    string(tokenType),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   fmt.Sprintf("%d", userID),
-	})
-	return token.SignedString(signingKey)
+	claims, err := keyring.newClaims(userID, tokenType, expiresIn)
+	if err != nil {
+		return "", err
+	}
+	return keyring.sign(claims)
 }
 
-// RefreshToken -
-func RefreshToken(tokenString, tokenSecret string) (string, error) {
-	claimsStruct := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&claimsStruct,
-		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
-	)
+// MakeAccessToken issues a first-party access token bound to the session
+// it was issued in, so revoking the session cuts it off too.
+func MakeAccessToken(userID int, sessionID string, keyring *Keyring, expiresIn time.Duration) (string, error) {
+	claims, err := keyring.newClaims(userID, TokenTypeAccess, expiresIn)
 	if err != nil {
 		return "", err
 	}
+	claims.SessionID = sessionID
+	return keyring.sign(claims)
+}
 
-	userIDString, err := token.Claims.GetSubject()
+// ValidateRefreshToken -
+func ValidateRefreshToken(tokenString string, keyring *Keyring) (string, error) {
+	claims, err := ParseToken(tokenString, keyring, TokenTypeRefresh)
 	if err != nil {
 		return "", err
 	}
+	return claims.Subject, nil
+}
 
-	issuer, err := token.Claims.GetIssuer()
+// ParseToken verifies a token of the given type and returns its claims.
+func ParseToken(tokenString string, keyring *Keyring, tokenType TokenType) (Claims, error) {
+	claims := Claims{}
+	err := keyring.parse(tokenString, &claims)
 	if err != nil {
-		return "", err
+		return Claims{}, err
 	}
-	if issuer != string(TokenTypeRefresh) {
-		return "", errors.New("invalid issuer")
+
+	err = keyring.checkClaims(claims, tokenType)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	return claims, nil
+}
+
+// GetBearerToken -
+func GetBearerToken(headers http.Header) (string, error) {
+	authHeader := headers.Get("Authorization")
+	if authHeader == "" {
+		return "", ErrNoAuthHeaderIncluded
+	}
+	splitAuth := strings.Split(authHeader, " ")
+	if len(splitAuth) < 2 || splitAuth[0] != "Bearer" {
+		return "", errors.New("malformed authorization header")
 	}
 
-	userID, err := strconv.Atoi(userIDString)
+	return splitAuth[1], nil
+}
+
+// IssuedAt returns the iat claim of a token. It doesn't verify the token and
+// must only be called after ParseToken or ValidateRefreshToken succeeded.
+func IssuedAt(tokenString string) (time.Time, error) {
+	claimsStruct := jwt.RegisteredClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(tokenString, &claimsStruct)
 	if err != nil {
-		return "", err
+		return time.Time{}, err
+	}
+	if claimsStruct.IssuedAt == nil {
+		return time.Time{}, errors.New("token has no issued at claim")
 	}
+	return claimsStruct.IssuedAt.Time, nil
+}
 
-	newToken, err := MakeJWT(
-		userID,
-		tokenSecret,
-		time.Hour,
-		TokenTypeAccess,
-	)
+// ExpiresAt returns the exp claim of a token. Like IssuedAt it doesn't
+// verify the token.
+func ExpiresAt(tokenString string) (time.Time, error) {
+	claimsStruct := jwt.RegisteredClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(tokenString, &claimsStruct)
 	if err != nil {
-		return "", err
+		return time.Time{}, err
+	}
+	if claimsStruct.ExpiresAt == nil {
+		return time.Time{}, errors.New("token has no expiry claim")
 	}
+	return claimsStruct.ExpiresAt.Time, nil
+}
 
-	return newToken, nil
+type emailClaims struct {
+	Claims
+	Email string `json:"email"`
 }
 
-// ValidateJWT -
-func ValidateJWT(tokenString, tokenSecret string) (string, error) {
-	claimsStruct := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&claimsStruct,
-		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
-	)
+// MakeEmailVerificationToken signs a token proving control of email. It is
+// bound to the address so it stops working once the user changes it.
+func MakeEmailVerificationToken(
+	userID int,
+	email string,
+	keyring *Keyring,
+	expiresIn time.Duration,
+) (string, error) {
+	claims, err := keyring.newClaims(userID, TokenTypeEmailVerification, expiresIn)
 	if err != nil {
 		return "", err
 	}
+	return keyring.sign(emailClaims{
+		Claims: claims,
+		Email:  email,
+	})
+}
 
-	userIDString, err := token.Claims.GetSubject()
+// ValidateEmailVerificationToken returns the user ID and email a
+// verification token was issued for.
+func ValidateEmailVerificationToken(tokenString string, keyring *Keyring) (int, string, error) {
+	claimsStruct := emailClaims{}
+	err := keyring.parse(tokenString, &claimsStruct)
 	if err != nil {
-		return "", err
+		return 0, "", err
 	}
 
-	issuer, err := token.Claims.GetIssuer()
+	err = keyring.checkClaims(claimsStruct.Claims, TokenTypeEmailVerification)
 	if err != nil {
-		return "", err
+		return 0, "", err
 	}
-	if issuer != string(TokenTypeAccess) {
-		return "", errors.New("invalid issuer")
+
+	userID, err := strconv.Atoi(claimsStruct.Subject)
+	if err != nil {
+		return 0, "", err
 	}
 
-	return userIDString, nil
+	return userID, claimsStruct.Email, nil
 }
 
-// GetBearerToken -
-func GetBearerToken(headers http.Header) (string, error) {
-	authHeader := headers.Get("Authorization")
-	if authHeader == "" {
-		return "", ErrNoAuthHeaderIncluded
-	}
-	splitAuth := strings.Split(authHeader, " ")
-	if len(splitAuth) < 2 || splitAuth[0] != "Bearer" {
-		return "", errors.New("malformed authorization header")
+// MakeRandomToken returns a 256-bit random token, hex encoded.
+func MakeRandomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(b), nil
+}
 
-	return splitAuth[1], nil
+// HashToken returns the SHA-256 of a token, hex encoded, for storing tokens
+// that only need to be looked up, never read back.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
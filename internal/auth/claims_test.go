@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "chirpy"
+	testAudience = "chirpy-api"
+)
+
+func TestParseToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	hsKey := NewSecretKey("hs256", []byte("secret"))
+	rsKey := Key{ID: "rs1", Method: jwt.SigningMethodRS256, private: rsaKey, public: &rsaKey.PublicKey}
+
+	// full mirrors the server: RS256 signs, HS256 verifies tokens from
+	// before the keyring. rsaOnly has no secret key at all.
+	full := NewKeyring(testIssuer, testAudience)
+	full.Add(hsKey)
+	full.Add(rsKey)
+	mustNotFail(t, full.SetFallback(hsKey.ID))
+	mustNotFail(t, full.SetActive(rsKey.ID))
+
+	rsaOnly := NewKeyring(testIssuer, testAudience)
+	rsaOnly.Add(rsKey)
+	mustNotFail(t, rsaOnly.SetActive(rsKey.ID))
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		method  jwt.SigningMethod
+		key     interface{}
+		kid     string
+		claims  func(*Claims)
+		wantErr error
+	}{
+		{
+			name:   "valid RS256",
+			method: jwt.SigningMethodRS256,
+			key:    rsaKey,
+			kid:    rsKey.ID,
+		},
+		{
+			name:   "valid HS256",
+			method: jwt.SigningMethodHS256,
+			key:    []byte("secret"),
+			kid:    hsKey.ID,
+		},
+		{
+			name:   "no kid uses fallback",
+			method: jwt.SigningMethodHS256,
+			key:    []byte("secret"),
+		},
+		{
+			name:   "wrong token type",
+			method: jwt.SigningMethodRS256,
+			key:    rsaKey,
+			kid:    rsKey.ID,
+			claims: func(c *Claims) {
+				c.TokenType = TokenTypeRefresh
+			},
+			wantErr: ErrWrongTokenType,
+		},
+		{
+			name:   "wrong issuer",
+			method: jwt.SigningMethodRS256,
+			key:    rsaKey,
+			kid:    rsKey.ID,
+			claims: func(c *Claims) {
+				c.Issuer = "someone-else"
+			},
+			wantErr: jwt.ErrTokenInvalidIssuer,
+		},
+		{
+			name:   "wrong audience",
+			method: jwt.SigningMethodRS256,
+			key:    rsaKey,
+			kid:    rsKey.ID,
+			claims: func(c *Claims) {
+				c.Audience = jwt.ClaimStrings{"other-api"}
+			},
+			wantErr: jwt.ErrTokenInvalidAudience,
+		},
+		{
+			name:   "missing subject",
+			method: jwt.SigningMethodRS256,
+			key:    rsaKey,
+			kid:    rsKey.ID,
+			claims: func(c *Claims) {
+				c.Subject = ""
+			},
+			wantErr: jwt.ErrTokenInvalidSubject,
+		},
+		{
+			name:   "missing jti",
+			method: jwt.SigningMethodRS256,
+			key:    rsaKey,
+			kid:    rsKey.ID,
+			claims: func(c *Claims) {
+				c.ID = ""
+			},
+			wantErr: jwt.ErrTokenInvalidId,
+		},
+		{
+			name:    "alg none",
+			method:  jwt.SigningMethodNone,
+			key:     jwt.UnsafeAllowNoneSignatureType,
+			kid:     rsKey.ID,
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "alg none without kid",
+			method:  jwt.SigningMethodNone,
+			key:     jwt.UnsafeAllowNoneSignatureType,
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "HS256 signed with the RSA public key",
+			method:  jwt.SigningMethodHS256,
+			key:     rsaPublicPEM,
+			kid:     rsKey.ID,
+			wantErr: jwt.ErrTokenUnverifiable,
+		},
+		{
+			name:    "HS256 signed with the RSA public key, no kid",
+			method:  jwt.SigningMethodHS256,
+			key:     rsaPublicPEM,
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "HS256 not in keyring",
+			keyring: rsaOnly,
+			method:  jwt.SigningMethodHS256,
+			key:     rsaPublicPEM,
+			kid:     rsKey.ID,
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "kid and alg mismatch",
+			method:  jwt.SigningMethodRS256,
+			key:     rsaKey,
+			kid:     hsKey.ID,
+			wantErr: jwt.ErrTokenUnverifiable,
+		},
+		{
+			name:    "unknown kid",
+			method:  jwt.SigningMethodRS256,
+			key:     rsaKey,
+			kid:     "retired",
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:    "no kid and no fallback",
+			keyring: rsaOnly,
+			method:  jwt.SigningMethodRS256,
+			key:     rsaKey,
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:   "expired within leeway",
+			method: jwt.SigningMethodRS256,
+			key:    rsaKey,
+			kid:    rsKey.ID,
+			claims: func(c *Claims) {
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-leeway / 2))
+			},
+		},
+		{
+			name:   "expired beyond leeway",
+			method: jwt.SigningMethodRS256,
+			key:    rsaKey,
+			kid:    rsKey.ID,
+			claims: func(c *Claims) {
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-2 * leeway))
+			},
+			wantErr: jwt.ErrTokenExpired,
+		},
+		{
+			name:   "missing expiry",
+			method: jwt.SigningMethodRS256,
+			key:    rsaKey,
+			kid:    rsKey.ID,
+			claims: func(c *Claims) {
+				c.ExpiresAt = nil
+			},
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:   "not valid yet beyond leeway",
+			method: jwt.SigningMethodRS256,
+			key:    rsaKey,
+			kid:    rsKey.ID,
+			claims: func(c *Claims) {
+				c.NotBefore = jwt.NewNumericDate(time.Now().Add(2 * leeway))
+			},
+			wantErr: jwt.ErrTokenNotValidYet,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			keyring := tc.keyring
+			if keyring == nil {
+				keyring = full
+			}
+
+			claims, err := full.newClaims(42, TokenTypeAccess, time.Minute)
+			mustNotFail(t, err)
+			if tc.claims != nil {
+				tc.claims(&claims)
+			}
+
+			token := jwt.NewWithClaims(tc.method, claims)
+			if tc.kid != "" {
+				token.Header["kid"] = tc.kid
+			}
+			tokenString, err := token.SignedString(tc.key)
+			mustNotFail(t, err)
+
+			got, err := ParseToken(tokenString, keyring, TokenTypeAccess)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("ParseToken() error = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			mustNotFail(t, err)
+			if got.Subject != "42" || got.TokenType != TokenTypeAccess {
+				t.Errorf("ParseToken() = %+v, want subject 42 and an access token", got)
+			}
+		})
+	}
+}
+
+func mustNotFail(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnknownKey is returned for tokens signed by a key the keyring doesn't
+// hold.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is a signing or verification key. Keys without a private half can
+// only verify, which is how retired keys are usually kept around.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// private is an *rsa.PrivateKey, ed25519.PrivateKey or []byte secret.
+	private interface{}
+	// public is an *rsa.PublicKey, ed25519.PublicKey or the []byte secret.
+	public interface{}
+}
+
+// NewSecretKey returns an HS256 key. Secret keys can't be published in the
+// JWKS, so they only suit tokens this server validates itself.
+func NewSecretKey(id string, secret []byte) Key {
+	return Key{
+		ID:      id,
+		Method:  jwt.SigningMethodHS256,
+		private: secret,
+		public:  secret,
+	}
+}
+
+// ParseKeyPEM parses a PKCS#8 private key or PKIX public key holding an RSA
+// (RS256) or Ed25519 (EdDSA) key.
+func ParseKeyPEM(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		switch private := private.(type) {
+		case *rsa.PrivateKey:
+			return Key{ID: id, Method: jwt.SigningMethodRS256, private: private, public: &private.PublicKey}, nil
+		case ed25519.PrivateKey:
+			return Key{ID: id, Method: jwt.SigningMethodEdDSA, private: private, public: private.Public()}, nil
+		}
+		return Key{}, fmt.Errorf("unsupported private key type %T", private)
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		return Key{ID: id, Method: jwt.SigningMethodRS256, private: private, public: &private.PublicKey}, nil
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		switch public := public.(type) {
+		case *rsa.PublicKey:
+			return Key{ID: id, Method: jwt.SigningMethodRS256, public: public}, nil
+		case ed25519.PublicKey:
+			return Key{ID: id, Method: jwt.SigningMethodEdDSA, public: public}, nil
+		}
+		return Key{}, fmt.Errorf("unsupported public key type %T", public)
+	}
+
+	return Key{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// CanSign reports whether the key holds its private half.
+func (k Key) CanSign() bool {
+	return k.private != nil
+}
+
+// Keyring holds the active signing key and the retired keys that tokens
+// issued before the last rotation are still verified with. It signs and
+// verifies tokens for a single issuer and audience.
+type Keyring struct {
+	issuer   string
+	audience string
+
+	mu       sync.RWMutex
+	keys     map[string]Key
+	activeID string
+	// fallbackID verifies tokens without a kid header, which were signed
+	// before the keyring existed.
+	fallbackID string
+}
+
+// NewKeyring returns an empty keyring issuing tokens as issuer for
+// audience.
+func NewKeyring(issuer, audience string) *Keyring {
+	return &Keyring{
+		issuer:   issuer,
+		audience: audience,
+		keys:     map[string]Key{},
+	}
+}
+
+// Add stores a key for verification.
+func (k *Keyring) Add(key Key) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[key.ID] = key
+}
+
+// SetActive selects the key new tokens are signed with.
+func (k *Keyring) SetActive(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[id]
+	if !ok {
+		return ErrUnknownKey
+	}
+	if !key.CanSign() {
+		return fmt.Errorf("key %q has no private key", id)
+	}
+	k.activeID = id
+	return nil
+}
+
+// SetFallback selects the key that verifies tokens without a kid header.
+func (k *Keyring) SetFallback(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[id]; !ok {
+		return ErrUnknownKey
+	}
+	k.fallbackID = id
+	return nil
+}
+
+// LoadDir adds every *.pem file in dir, using the file name without the
+// extension as the kid. The key named activeID becomes the signing key; if
+// activeID is empty the last signing-capable kid in lexical order is used, so
+// naming keys by date activates the newest one.
+func (k *Keyring) LoadDir(dir, activeID string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	lastSigner := ""
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParseKeyPEM(id, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		k.Add(key)
+		if key.CanSign() {
+			lastSigner = id
+		}
+	}
+
+	if activeID == "" {
+		activeID = lastSigner
+	}
+	if activeID == "" {
+		return fmt.Errorf("no signing key found in %s", dir)
+	}
+
+	return k.SetActive(activeID)
+}
+
+// sign signs the claims with the active key and names it in the kid header.
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	key, ok := k.keys[k.activeID]
+	k.mu.RUnlock()
+	if !ok {
+		return "", errors.New("keyring has no active signing key")
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// keyfunc picks the verification key named by the token's kid header and
+// refuses tokens whose algorithm doesn't match that key.
+func (k *Keyring) keyfunc(token *jwt.Token) (interface{}, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	id, ok := token.Header["kid"].(string)
+	if !ok {
+		id = k.fallbackID
+		if id == "" {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+
+	return key.public, nil
+}
+
+// JWK is a public key in JSON Web Key form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public halves of every asymmetric key, active and
+// retired, sorted by kid. Secret keys are never published.
+func (k *Keyring) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range k.keys {
+		jwk, ok := publicJWK(key)
+		if ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].KeyID < set.Keys[j].KeyID
+	})
+
+	return set
+}
+
+func publicJWK(key Key) (JWK, bool) {
+	encode := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{
+		KeyID:     key.ID,
+		Use:       "sig",
+		Algorithm: key.Method.Alg(),
+	}
+
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encode(public.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+		return jwk, true
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = encode(public)
+		return jwk, true
+	}
+
+	return JWK{}, false
+}
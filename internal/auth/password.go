@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms.
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var (
+	// ErrPasswordMismatch is returned when a password doesn't match its
+	// hash.
+	ErrPasswordMismatch = errors.New("password doesn't match")
+	// ErrUnsupportedHash is returned for hashes in an unknown format.
+	ErrUnsupportedHash = errors.New("unsupported password hash")
+)
+
+// Argon2Params are the argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params are the OWASP recommended minimums.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// PasswordHasher hashes new passwords with one algorithm and verifies hashes
+// made with any supported one. argon2id hashes are PHC strings; bcrypt
+// hashes keep their usual $2a$ form.
+type PasswordHasher struct {
+	algorithm  string
+	argon2     Argon2Params
+	bcryptCost int
+
+	dummyOnce   sync.Once
+	dummyHashes map[string]string
+}
+
+// NewArgon2idHasher -
+func NewArgon2idHasher(params Argon2Params) *PasswordHasher {
+	return &PasswordHasher{algorithm: AlgorithmArgon2id, argon2: params}
+}
+
+// NewBcryptHasher -
+func NewBcryptHasher(cost int) *PasswordHasher {
+	return &PasswordHasher{algorithm: AlgorithmBcrypt, bcryptCost: cost}
+}
+
+// Algorithm returns the algorithm new hashes are made with.
+func (h *PasswordHasher) Algorithm() string {
+	return h.algorithm
+}
+
+// Hash -
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.algorithm == AlgorithmBcrypt {
+		dat, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(dat), nil
+	}
+
+	salt := make([]byte, h.argon2.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.argon2.Iterations, h.argon2.Memory, h.argon2.Parallelism, h.argon2.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.argon2.Memory,
+		h.argon2.Iterations,
+		h.argon2.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Check returns nil if password matches hash, whichever supported algorithm
+// made it.
+func (h *PasswordHasher) Check(password, hash string) error {
+	if isBcryptHash(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return err
+	}
+
+	params, salt, key, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or other
+// parameters than new hashes are, so it should be replaced the next time
+// the password is known.
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	if h.algorithm == AlgorithmBcrypt {
+		if !isBcryptHash(hash) {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.bcryptCost
+	}
+
+	params, _, _, err := decodeArgon2idHash(hash)
+	return err != nil || params != h.argon2
+}
+
+// CheckLogin is Check for logins, where the time taken mustn't reveal
+// whether an account exists. Besides checking hash, it checks password
+// against a dummy hash of every other supported algorithm, so it takes as
+// long as CheckDummy whether the account's hash is current or legacy.
+func (h *PasswordHasher) CheckLogin(password, hash string) error {
+	algorithm := AlgorithmArgon2id
+	if isBcryptHash(hash) {
+		algorithm = AlgorithmBcrypt
+	}
+	for other, dummyHash := range h.dummies() {
+		if other != algorithm {
+			h.Check(password, dummyHash)
+		}
+	}
+	return h.Check(password, hash)
+}
+
+// CheckDummy checks password against a dummy hash of every supported
+// algorithm, so a login for an unknown email takes as long as CheckLogin.
+func (h *PasswordHasher) CheckDummy(password string) {
+	for _, dummyHash := range h.dummies() {
+		h.Check(password, dummyHash)
+	}
+}
+
+// dummies returns a hash of a throwaway password per algorithm, made with
+// the configured costs or, for the algorithm not in use, the defaults.
+func (h *PasswordHasher) dummies() map[string]string {
+	h.dummyOnce.Do(func() {
+		argon2Params := h.argon2
+		if h.algorithm != AlgorithmArgon2id {
+			argon2Params = DefaultArgon2Params
+		}
+		bcryptCost := h.bcryptCost
+		if h.algorithm != AlgorithmBcrypt {
+			bcryptCost = bcrypt.DefaultCost
+		}
+
+		h.dummyHashes = map[string]string{}
+		for _, hasher := range []*PasswordHasher{NewArgon2idHasher(argon2Params), NewBcryptHasher(bcryptCost)} {
+			hash, err := hasher.Hash("chirpy-dummy-password")
+			if err == nil {
+				h.dummyHashes[hasher.algorithm] = hash
+			}
+		}
+	})
+	return h.dummyHashes
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// decodeArgon2idHash parses a PHC string of the form
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>.
+func decodeArgon2idHash(hash string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != AlgorithmArgon2id {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+
+	params := Argon2Params{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, ErrUnsupportedHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// TokenTypeAPIKey marks principals authenticated with a personal API key.
+const TokenTypeAPIKey TokenType = "chirpy-api-key"
+
+// Principal is the authenticated caller of a request. ClientID is set when
+// an OAuth client acts on the user's behalf.
+type Principal struct {
+	UserID    int
+	TokenType TokenType
+	ClientID  string
+	Scopes    []Scope
+}
+
+// HasScope -
+func (p Principal) HasScope(scope Scope) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying p.
+func ContextWithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored by ContextWithPrincipal.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// MustPrincipal is PrincipalFromContext for handlers behind middleware that
+// guarantees a principal. A missing principal is a routing bug, so it
+// panics.
+func MustPrincipal(ctx context.Context) Principal {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		panic("auth: no principal in context")
+	}
+	return p
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// apiKeyTouchInterval limits how often LastUsedAt is written, so a busy bot
+// doesn't rewrite the database on every request.
+const apiKeyTouchInterval = time.Minute
+
+// APIKey is a personal API key. Only the key's hash is stored.
+type APIKey struct {
+	ID         string    `json:"id"`
+	UserID     int       `json:"user_id"`
+	Name       string    `json:"name"`
+	KeyHash    string    `json:"key_hash"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	RevokedAt  time.Time `json:"revoked_at"`
+}
+
+// Active reports whether the key can still be used.
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt.IsZero() && (k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt))
+}
+
+// HasScope -
+func (k APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+func (db *DB) CreateAPIKey(key APIKey) (APIKey, error) {
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.APIKeys[key.ID]; ok {
+			return ErrAlreadyExists
+		}
+
+		key.CreatedAt = time.Now().UTC()
+		dbStructure.APIKeys[key.ID] = key
+		return nil
+	})
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	return key, nil
+}
+
+func (db *DB) GetAPIKey(id string) (APIKey, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	key, ok := dbStructure.APIKeys[id]
+	if !ok {
+		return APIKey{}, ErrNotExist
+	}
+
+	return key, nil
+}
+
+// GetAPIKeys returns the user's active keys, newest first.
+func (db *DB) GetAPIKeys(userID int) ([]APIKey, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	keys := []APIKey{}
+	for _, key := range dbStructure.APIKeys {
+		if key.UserID == userID && key.Active(now) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes one of the user's keys. Keys belonging to someone
+// else return ErrNotExist.
+func (db *DB) RevokeAPIKey(userID int, id string) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		key, ok := dbStructure.APIKeys[id]
+		if !ok || key.UserID != userID {
+			return ErrNotExist
+		}
+		if !key.RevokedAt.IsZero() {
+			return errNoChanges
+		}
+
+		key.RevokedAt = time.Now().UTC()
+		dbStructure.APIKeys[id] = key
+		return nil
+	})
+}
+
+// TouchAPIKey records that the key was used at now.
+func (db *DB) TouchAPIKey(id string, now time.Time) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		key, ok := dbStructure.APIKeys[id]
+		if !ok {
+			return ErrNotExist
+		}
+		if now.Sub(key.LastUsedAt) < apiKeyTouchInterval {
+			return errNoChanges
+		}
+
+		key.LastUsedAt = now
+		dbStructure.APIKeys[id] = key
+		return nil
+	})
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+type ModerationActionType string
+
+const (
+	ModerationActionHideChirp   ModerationActionType = "hide_chirp"
+	ModerationActionSuspendUser ModerationActionType = "suspend_user"
+	ModerationActionDismiss     ModerationActionType = "dismiss"
+	ModerationActionSetState    ModerationActionType = "set_state"
+	ModerationActionDeleteUser  ModerationActionType = "delete_user"
+	// ModerationActionLockAccount is recorded by the server, not a
+	// moderator, when repeated failed logins lock an account.
+	ModerationActionLockAccount ModerationActionType = "lock_account"
+)
+
+type ModerationAction struct {
+	ID         int                  `json:"id"`
+	Moderator  string               `json:"moderator"`
+	Action     ModerationActionType `json:"action"`
+	ReportID   int                  `json:"report_id"`
+	TargetType ReportTarget         `json:"target_type"`
+	TargetID   int                  `json:"target_id"`
+	Note       string               `json:"note"`
+	CreatedAt  time.Time            `json:"created_at"`
+}
+
+// LogModerationAction appends an entry to the moderation audit log. Entries
+// are never modified or removed.
+func (db *DB) LogModerationAction(action ModerationAction) (ModerationAction, error) {
+	err := db.update(func(dbStructure *DBStructure) error {
+		action = dbStructure.logModerationAction(action, time.Now().UTC())
+		return nil
+	})
+	if err != nil {
+		return ModerationAction{}, err
+	}
+
+	return action, nil
+}
+
+func (s *DBStructure) logModerationAction(action ModerationAction, now time.Time) ModerationAction {
+	action.ID = nextID(s.ModerationActions)
+	action.CreatedAt = now
+	s.ModerationActions[action.ID] = action
+	return action
+}
+
+func (db *DB) GetModerationActions() ([]ModerationAction, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]ModerationAction, 0, len(dbStructure.ModerationActions))
+	for _, action := range dbStructure.ModerationActions {
+		actions = append(actions, action)
+	}
+
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].ID < actions[j].ID
+	})
+
+	return actions, nil
+}
@@ -1,26 +1,56 @@
 package database
 
+import "time"
+
 type Chirp struct {
-	ID       int    `json:"id"`
-	Body     string `json:"body"`
-	AuthorID int    `json:"author_id"`
+	ID        int       `json:"id"`
+	Body      string    `json:"body"`
+	AuthorID  int       `json:"author_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Preview   *Preview  `json:"preview,omitempty"`
+	Flagged   bool      `json:"flagged"`
+	Hidden    bool      `json:"hidden"`
+	Held      bool      `json:"held"`
 }
 
-func (db *DB) CreateChirp(body string, authorID int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return Chirp{}, err
-	}
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	SiteName    string `json:"site_name"`
+}
 
-	id := len(dbStructure.Chirps) + 1
-	chirp := Chirp{
-		ID:       id,
-		Body:     body,
-		AuthorID: authorID,
-	}
-	dbStructure.Chirps[id] = chirp
+// ChirpReview marks a new chirp for moderation. A non-empty Reason queues
+// the chirp for review with an automated report.
+type ChirpReview struct {
+	Flagged bool
+	Held    bool
+	Reason  string
+}
 
-	err = db.writeDB(dbStructure)
+// CreateChirp stores a chirp along with its review state and report in a
+// single write, so a held chirp is never visible.
+func (db *DB) CreateChirp(body string, authorID int, review ChirpReview) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		now := time.Now().UTC()
+		id := nextID(dbStructure.Chirps)
+		chirp = Chirp{
+			ID:        id,
+			Body:      body,
+			AuthorID:  authorID,
+			CreatedAt: now,
+			Flagged:   review.Flagged,
+			Held:      review.Held,
+		}
+		dbStructure.Chirps[id] = chirp
+
+		if review.Reason != "" {
+			dbStructure.addReport(0, ReportTargetChirp, id, ReportReasonAutomatedFlag, review.Reason, now)
+		}
+		return nil
+	})
 	if err != nil {
 		return Chirp{}, err
 	}
@@ -57,24 +87,13 @@ func (db *DB) GetChirp(id int) (Chirp, error) {
 }
 
 func (db *DB) DeleteChirp(id int) error {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
-	}
-
-	_, ok := dbStructure.Chirps[id]
-	if !ok {
-		return ErrNotExist
-	}
-
-	delete(dbStructure.Chirps, id)
-
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Chirps[id]; !ok {
+			return ErrNotExist
+		}
+		delete(dbStructure.Chirps, id)
+		return nil
+	})
 }
 
 func (db *DB) GetChirpsByAuthorID(authorID int) ([]Chirp, error) {
@@ -92,3 +111,29 @@ func (db *DB) GetChirpsByAuthorID(authorID int) ([]Chirp, error) {
 
 	return chirps, nil
 }
+
+func (db *DB) SetChirpPreview(id int, preview Preview) (Chirp, error) {
+	return db.updateChirp(id, func(chirp *Chirp) {
+		chirp.Preview = &preview
+	})
+}
+
+// updateChirp applies fn to a chirp and returns the result.
+func (db *DB) updateChirp(id int, fn func(*Chirp)) (Chirp, error) {
+	var chirp Chirp
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.Chirps[id]
+		if !ok {
+			return ErrNotExist
+		}
+		fn(&chirp)
+		dbStructure.Chirps[id] = chirp
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return chirp, nil
+}
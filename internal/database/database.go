@@ -9,15 +9,33 @@ import (
 
 var ErrNotExist = errors.New("resource does not exist")
 
+// errNoChanges tells update that fn changed nothing, so there is nothing to
+// write.
+var errNoChanges = errors.New("no changes")
+
 type DB struct {
 	path string
 	mu   *sync.RWMutex
 }
 
 type DBStructure struct {
-	Chirps      map[int]Chirp         `json:"chirps"`
-	Users       map[int]User          `json:"users"`
-	Revocations map[string]Revocation `json:"revocations"`
+	Chirps            map[int]Chirp            `json:"chirps"`
+	Users             map[int]User             `json:"users"`
+	Revocations       map[string]Revocation    `json:"revocations"`
+	Reports           map[int]Report           `json:"reports"`
+	ModerationActions map[int]ModerationAction `json:"moderation_actions"`
+	Blocks            map[string]Block         `json:"blocks"`
+	Mutes             map[string]Mute          `json:"mutes"`
+	Exports           map[string]DataExport    `json:"exports"`
+	PasswordResets    map[string]PasswordReset `json:"password_resets"`
+	TokenFamilies     map[string]TokenFamily   `json:"token_families"`
+	RefreshTokens     map[string]RefreshToken  `json:"refresh_tokens"`
+	APIKeys           map[string]APIKey        `json:"api_keys"`
+	OAuthClients      map[string]OAuthClient   `json:"oauth_clients"`
+	// AuthorizationCodes are keyed by code hash, OAuthConsents by
+	// "userID:clientID".
+	AuthorizationCodes map[string]AuthorizationCode `json:"authorization_codes"`
+	OAuthConsents      map[string]OAuthConsent      `json:"oauth_consents"`
 }
 
 func NewDB(path string) (*DB, error) {
@@ -30,11 +48,8 @@ func NewDB(path string) (*DB, error) {
 }
 
 func (db *DB) createDB() error {
-	dbStructure := DBStructure{
-		Chirps:      map[int]Chirp{},
-		Users:       map[int]User{},
-		Revocations: map[string]Revocation{},
-	}
+	dbStructure := DBStructure{}
+	dbStructure.ensureMaps()
 	return db.writeDB(dbStructure)
 }
 
@@ -54,10 +69,50 @@ func (db *DB) ResetDB() error {
 	return db.ensureDB()
 }
 
+// nextID returns an ID one past the highest in use, so IDs of deleted rows
+// are never handed out again.
+func nextID[T any](table map[int]T) int {
+	maxID := 0
+	for id := range table {
+		if id > maxID {
+			maxID = id
+		}
+	}
+	return maxID + 1
+}
+
 func (db *DB) loadDB() (DBStructure, error) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
+	return db.read()
+}
+
+// update applies fn to the current contents and writes them back, holding
+// the lock throughout so concurrent updates can't overwrite each other.
+// Nothing is written if fn returns an error; errNoChanges skips the write
+// without failing.
+func (db *DB) update(fn func(*DBStructure) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	dbStructure, err := db.read()
+	if err != nil {
+		return err
+	}
+
+	err = fn(&dbStructure)
+	if errors.Is(err, errNoChanges) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
+	return db.write(dbStructure)
+}
+
+// read and write expect the caller to hold db.mu.
+func (db *DB) read() (DBStructure, error) {
 	dbStructure := DBStructure{}
 	dat, err := os.ReadFile(db.path)
 	if errors.Is(err, os.ErrNotExist) {
@@ -67,14 +122,69 @@ func (db *DB) loadDB() (DBStructure, error) {
 	if err != nil {
 		return dbStructure, err
 	}
+	dbStructure.ensureMaps()
+	dbStructure.migrateRevocations()
 
 	return dbStructure, nil
 }
 
+// ensureMaps initializes tables missing from databases written by older
+// versions.
+func (s *DBStructure) ensureMaps() {
+	if s.Chirps == nil {
+		s.Chirps = map[int]Chirp{}
+	}
+	if s.Users == nil {
+		s.Users = map[int]User{}
+	}
+	if s.Revocations == nil {
+		s.Revocations = map[string]Revocation{}
+	}
+	if s.Reports == nil {
+		s.Reports = map[int]Report{}
+	}
+	if s.ModerationActions == nil {
+		s.ModerationActions = map[int]ModerationAction{}
+	}
+	if s.Blocks == nil {
+		s.Blocks = map[string]Block{}
+	}
+	if s.Mutes == nil {
+		s.Mutes = map[string]Mute{}
+	}
+	if s.Exports == nil {
+		s.Exports = map[string]DataExport{}
+	}
+	if s.PasswordResets == nil {
+		s.PasswordResets = map[string]PasswordReset{}
+	}
+	if s.TokenFamilies == nil {
+		s.TokenFamilies = map[string]TokenFamily{}
+	}
+	if s.RefreshTokens == nil {
+		s.RefreshTokens = map[string]RefreshToken{}
+	}
+	if s.APIKeys == nil {
+		s.APIKeys = map[string]APIKey{}
+	}
+	if s.OAuthClients == nil {
+		s.OAuthClients = map[string]OAuthClient{}
+	}
+	if s.AuthorizationCodes == nil {
+		s.AuthorizationCodes = map[string]AuthorizationCode{}
+	}
+	if s.OAuthConsents == nil {
+		s.OAuthConsents = map[string]OAuthConsent{}
+	}
+}
+
 func (db *DB) writeDB(dbStructure DBStructure) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
+	return db.write(dbStructure)
+}
 
+func (db *DB) write(dbStructure DBStructure) error {
 	dat, err := json.Marshal(dbStructure)
 	if err != nil {
 		return err
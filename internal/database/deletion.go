@@ -0,0 +1,167 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrDeletionNotCancellable = errors.New("deletion was scheduled by a moderator")
+
+// ScheduleUserDeletion starts the deletion grace period for a user and
+// revokes all of their tokens. requestedBy is the moderator asking for it,
+// or empty when it is the user. The account is purged by
+// PurgeScheduledDeletions once at has passed. A deletion a moderator
+// scheduled is left as it is when the user asks for one too.
+func (db *DB) ScheduleUserDeletion(id int, at time.Time, requestedBy string) (User, error) {
+	return db.updateUser(id, func(dbStructure *DBStructure, user *User) error {
+		if user.PendingDeletion() && !user.DeletionCancellable() && requestedBy == "" {
+			return errNoChanges
+		}
+
+		user.DeletionScheduledFor = at
+		user.DeletionRequestedBy = requestedBy
+		user.TokensRevokedAt = time.Now().UTC()
+		return nil
+	})
+}
+
+// CancelUserDeletion restores an account pending deletion. It fails with
+// ErrDeletionNotCancellable if a moderator scheduled the deletion.
+func (db *DB) CancelUserDeletion(id int) (User, error) {
+	return db.updateUser(id, func(dbStructure *DBStructure, user *User) error {
+		if !user.DeletionCancellable() {
+			return ErrDeletionNotCancellable
+		}
+
+		user.DeletionScheduledFor = time.Time{}
+		return nil
+	})
+}
+
+// DeleteUser removes a user and everything that belongs to them in a
+// single write.
+func (db *DB) DeleteUser(id int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[id]; !ok {
+			return ErrNotExist
+		}
+		dbStructure.deleteUser(id)
+		return nil
+	})
+}
+
+// PurgeScheduledDeletions deletes every user whose grace period ended
+// before now and returns their IDs.
+func (db *DB) PurgeScheduledDeletions(now time.Time) ([]int, error) {
+	purged := []int{}
+	err := db.update(func(dbStructure *DBStructure) error {
+		for id, user := range dbStructure.Users {
+			if user.PendingDeletion() && now.After(user.DeletionScheduledFor) {
+				purged = append(purged, id)
+			}
+		}
+		if len(purged) == 0 {
+			return errNoChanges
+		}
+
+		for _, id := range purged {
+			dbStructure.deleteUser(id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return purged, nil
+}
+
+// deleteUser removes the user, their chirps, revocations, blocks, mutes,
+// data exports, password resets, refresh token families, API keys, OAuth
+// clients and consents and the reports they filed. Reports about the user
+// and the moderation audit log are kept.
+func (s *DBStructure) deleteUser(id int) {
+	delete(s.Users, id)
+
+	for chirpID, chirp := range s.Chirps {
+		if chirp.AuthorID == id {
+			delete(s.Chirps, chirpID)
+		}
+	}
+	for tokenHash, revocation := range s.Revocations {
+		if revocation.UserID == id {
+			delete(s.Revocations, tokenHash)
+		}
+	}
+	for key, block := range s.Blocks {
+		if block.BlockerID == id || block.BlockedID == id {
+			delete(s.Blocks, key)
+		}
+	}
+	for key, mute := range s.Mutes {
+		if mute.MuterID == id || mute.MutedID == id {
+			delete(s.Mutes, key)
+		}
+	}
+	for reportID, report := range s.Reports {
+		if report.ReporterID == id {
+			delete(s.Reports, reportID)
+		}
+	}
+	for exportID, export := range s.Exports {
+		if export.UserID == id {
+			delete(s.Exports, exportID)
+		}
+	}
+	for tokenHash, reset := range s.PasswordResets {
+		if reset.UserID == id {
+			delete(s.PasswordResets, tokenHash)
+		}
+	}
+	for familyID, family := range s.TokenFamilies {
+		if family.UserID == id {
+			delete(s.TokenFamilies, familyID)
+		}
+	}
+	for tokenHash, token := range s.RefreshTokens {
+		if token.UserID == id {
+			delete(s.RefreshTokens, tokenHash)
+		}
+	}
+	for keyID, key := range s.APIKeys {
+		if key.UserID == id {
+			delete(s.APIKeys, keyID)
+		}
+	}
+	for clientID, client := range s.OAuthClients {
+		if client.OwnerID == id {
+			s.deleteOAuthClient(clientID)
+		}
+	}
+	for codeHash, code := range s.AuthorizationCodes {
+		if code.UserID == id {
+			delete(s.AuthorizationCodes, codeHash)
+		}
+	}
+	for key, consent := range s.OAuthConsents {
+		if consent.UserID == id {
+			delete(s.OAuthConsents, key)
+		}
+	}
+}
+
+func (db *DB) GetPendingDeletionUserIDs() (map[int]struct{}, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[int]struct{}{}
+	for _, user := range dbStructure.Users {
+		if user.PendingDeletion() {
+			ids[user.ID] = struct{}{}
+		}
+	}
+
+	return ids, nil
+}
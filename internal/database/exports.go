@@ -0,0 +1,232 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+type ExportStatus string
+
+const (
+	ExportStatusPending ExportStatus = "pending"
+	ExportStatusReady   ExportStatus = "ready"
+	ExportStatusFailed  ExportStatus = "failed"
+)
+
+type DataExport struct {
+	ID          string       `json:"id"`
+	UserID      int          `json:"user_id"`
+	Status      ExportStatus `json:"status"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CompletedAt time.Time    `json:"completed_at"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+}
+
+// UserData is everything stored about a single user.
+type UserData struct {
+	User     User          `json:"user"`
+	Chirps   []Chirp       `json:"chirps"`
+	Reports  []Report      `json:"reports"`
+	Blocks   []Block       `json:"blocks"`
+	Mutes    []Mute        `json:"mutes"`
+	Sessions []TokenFamily `json:"sessions"`
+	APIKeys  []APIKey      `json:"api_keys"`
+	Exports  []DataExport  `json:"exports"`
+	// OAuthClients are the applications the user registered and
+	// OAuthConsents the ones they granted access to.
+	OAuthClients  []OAuthClient  `json:"oauth_clients"`
+	OAuthConsents []OAuthConsent `json:"oauth_consents"`
+}
+
+// CreateExport queues a data export for a user. It returns ErrAlreadyExists
+// if one is still pending.
+func (db *DB) CreateExport(userID int) (DataExport, error) {
+	id, err := randomID()
+	if err != nil {
+		return DataExport{}, err
+	}
+	export := DataExport{
+		ID:        id,
+		UserID:    userID,
+		Status:    ExportStatusPending,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	err = db.update(func(dbStructure *DBStructure) error {
+		for _, other := range dbStructure.Exports {
+			if other.UserID == userID && other.Status == ExportStatusPending {
+				return ErrAlreadyExists
+			}
+		}
+		dbStructure.Exports[id] = export
+		return nil
+	})
+	if err != nil {
+		return DataExport{}, err
+	}
+
+	return export, nil
+}
+
+func (db *DB) GetExport(id string) (DataExport, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return DataExport{}, err
+	}
+
+	export, ok := dbStructure.Exports[id]
+	if !ok {
+		return DataExport{}, ErrNotExist
+	}
+
+	return export, nil
+}
+
+// CompleteExport records the outcome of an export. expiresAt is ignored
+// for failed exports.
+func (db *DB) CompleteExport(id string, status ExportStatus, expiresAt time.Time) (DataExport, error) {
+	var export DataExport
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		export, ok = dbStructure.Exports[id]
+		if !ok {
+			return ErrNotExist
+		}
+
+		export.Status = status
+		export.CompletedAt = time.Now().UTC()
+		if status == ExportStatusReady {
+			export.ExpiresAt = expiresAt
+		}
+		dbStructure.Exports[id] = export
+		return nil
+	})
+	if err != nil {
+		return DataExport{}, err
+	}
+
+	return export, nil
+}
+
+// FailPendingExports marks every pending export as failed and returns how
+// many there were. Exports are built by the running server, so any still
+// pending at startup were interrupted and will never finish.
+func (db *DB) FailPendingExports() (int, error) {
+	failed := 0
+	err := db.update(func(dbStructure *DBStructure) error {
+		now := time.Now().UTC()
+		for id, export := range dbStructure.Exports {
+			if export.Status != ExportStatusPending {
+				continue
+			}
+			export.Status = ExportStatusFailed
+			export.CompletedAt = now
+			dbStructure.Exports[id] = export
+			failed++
+		}
+		if failed == 0 {
+			return errNoChanges
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return failed, nil
+}
+
+func (db *DB) DeleteExport(id string) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Exports[id]; !ok {
+			return ErrNotExist
+		}
+		delete(dbStructure.Exports, id)
+		return nil
+	})
+}
+
+// GetUserData collects every record that belongs to or was created by a
+// user from a single snapshot of the database.
+func (db *DB) GetUserData(userID int) (UserData, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return UserData{}, err
+	}
+
+	user, ok := dbStructure.Users[userID]
+	if !ok {
+		return UserData{}, ErrNotExist
+	}
+
+	data := UserData{
+		User:     user,
+		Chirps:   []Chirp{},
+		Reports:  []Report{},
+		Blocks:   []Block{},
+		Mutes:    []Mute{},
+		Sessions: []TokenFamily{},
+		APIKeys:  []APIKey{},
+		Exports:  []DataExport{},
+
+		OAuthClients:  []OAuthClient{},
+		OAuthConsents: []OAuthConsent{},
+	}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.AuthorID == userID {
+			data.Chirps = append(data.Chirps, chirp)
+		}
+	}
+	for _, report := range dbStructure.Reports {
+		if report.ReporterID == userID {
+			data.Reports = append(data.Reports, report)
+		}
+	}
+	for _, block := range dbStructure.Blocks {
+		if block.BlockerID == userID {
+			data.Blocks = append(data.Blocks, block)
+		}
+	}
+	for _, mute := range dbStructure.Mutes {
+		if mute.MuterID == userID {
+			data.Mutes = append(data.Mutes, mute)
+		}
+	}
+	for _, family := range dbStructure.TokenFamilies {
+		if family.UserID == userID {
+			data.Sessions = append(data.Sessions, family)
+		}
+	}
+	for _, key := range dbStructure.APIKeys {
+		if key.UserID == userID {
+			data.APIKeys = append(data.APIKeys, key)
+		}
+	}
+	for _, export := range dbStructure.Exports {
+		if export.UserID == userID {
+			data.Exports = append(data.Exports, export)
+		}
+	}
+	for _, client := range dbStructure.OAuthClients {
+		if client.OwnerID == userID {
+			data.OAuthClients = append(data.OAuthClients, client)
+		}
+	}
+	for _, consent := range dbStructure.OAuthConsents {
+		if consent.UserID == userID {
+			data.OAuthConsents = append(data.OAuthConsents, consent)
+		}
+	}
+
+	return data, nil
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"slices"
+)
+
+// SetPendingMFASecret starts enrollment. The secret only takes effect once
+// EnableMFA confirms the user could generate a code from it.
+func (db *DB) SetPendingMFASecret(userID int, sealedSecret string) error {
+	return db.updateMFA(userID, func(user *User) error {
+		user.MFAPendingSecret = sealedSecret
+		return nil
+	})
+}
+
+// EnableMFA promotes the pending secret and stores the recovery codes.
+// step is the period of the code that confirmed enrollment.
+func (db *DB) EnableMFA(userID int, step int64, recoveryCodeHashes []string) error {
+	return db.updateMFA(userID, func(user *User) error {
+		if user.MFAPendingSecret == "" {
+			return ErrNotExist
+		}
+		user.MFASecret = user.MFAPendingSecret
+		user.MFAPendingSecret = ""
+		user.MFALastStep = step
+		user.RecoveryCodeHashes = recoveryCodeHashes
+		return nil
+	})
+}
+
+// DisableMFA turns two-factor authentication off and forgets the secret
+// and recovery codes.
+func (db *DB) DisableMFA(userID int) error {
+	return db.updateMFA(userID, func(user *User) error {
+		user.MFASecret = ""
+		user.MFAPendingSecret = ""
+		user.MFALastStep = 0
+		user.RecoveryCodeHashes = nil
+		return nil
+	})
+}
+
+// UseMFAStep records that a code for step was accepted. Codes for the same
+// or an earlier period return ErrTokenInvalid.
+func (db *DB) UseMFAStep(userID int, step int64) error {
+	return db.updateMFA(userID, func(user *User) error {
+		if step <= user.MFALastStep {
+			return ErrTokenInvalid
+		}
+		user.MFALastStep = step
+		return nil
+	})
+}
+
+// UseRecoveryCode spends a recovery code. Unknown or spent codes return
+// ErrTokenInvalid.
+func (db *DB) UseRecoveryCode(userID int, codeHash string) error {
+	return db.updateMFA(userID, func(user *User) error {
+		i := slices.Index(user.RecoveryCodeHashes, codeHash)
+		if i < 0 {
+			return ErrTokenInvalid
+		}
+		user.RecoveryCodeHashes = slices.Delete(user.RecoveryCodeHashes, i, i+1)
+		return nil
+	})
+}
+
+func (db *DB) updateMFA(userID int, update func(user *User) error) error {
+	_, err := db.updateUser(userID, func(dbStructure *DBStructure, user *User) error {
+		return update(user)
+	})
+	return err
+}
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// OAuthClient is a third-party application registered by a user. Public
+// clients, such as mobile apps, have no secret.
+type OAuthClient struct {
+	ID           string    `json:"id"`
+	OwnerID      int       `json:"owner_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	SecretHash   string    `json:"secret_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Confidential reports whether the client authenticates with a secret.
+func (c OAuthClient) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+// AuthorizationCode is a single-use OAuth authorization code, keyed by its
+// hash.
+type AuthorizationCode struct {
+	CodeHash      string    `json:"code_hash"`
+	ClientID      string    `json:"client_id"`
+	UserID        int       `json:"user_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scopes        []string  `json:"scopes"`
+	CodeChallenge string    `json:"code_challenge"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	UsedAt        time.Time `json:"used_at"`
+	// FamilyID is the session the code was exchanged for, revoked if the
+	// code is ever presented again.
+	FamilyID string `json:"family_id"`
+}
+
+// OAuthConsent records the scopes a user granted a client, so they aren't
+// asked again.
+type OAuthConsent struct {
+	UserID    int       `json:"user_id"`
+	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+func consentKey(userID int, clientID string) string {
+	return fmt.Sprintf("%d:%s", userID, clientID)
+}
+
+func (db *DB) CreateOAuthClient(client OAuthClient) (OAuthClient, error) {
+	id, err := randomID()
+	if err != nil {
+		return OAuthClient{}, err
+	}
+	client.ID = id
+	client.CreatedAt = time.Now().UTC()
+
+	err = db.update(func(dbStructure *DBStructure) error {
+		dbStructure.OAuthClients[id] = client
+		return nil
+	})
+	if err != nil {
+		return OAuthClient{}, err
+	}
+
+	return client, nil
+}
+
+func (db *DB) GetOAuthClient(id string) (OAuthClient, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return OAuthClient{}, err
+	}
+
+	client, ok := dbStructure.OAuthClients[id]
+	if !ok {
+		return OAuthClient{}, ErrNotExist
+	}
+
+	return client, nil
+}
+
+// GetOAuthClientsByOwner returns the clients a user registered, newest
+// first.
+func (db *DB) GetOAuthClientsByOwner(ownerID int) ([]OAuthClient, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	clients := []OAuthClient{}
+	for _, client := range dbStructure.OAuthClients {
+		if client.OwnerID == ownerID {
+			clients = append(clients, client)
+		}
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CreatedAt.After(clients[j].CreatedAt)
+	})
+
+	return clients, nil
+}
+
+// DeleteOAuthClient removes a client the user owns, along with its codes
+// and consents, and revokes every session issued to it.
+func (db *DB) DeleteOAuthClient(ownerID int, id string) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		client, ok := dbStructure.OAuthClients[id]
+		if !ok || client.OwnerID != ownerID {
+			return ErrNotExist
+		}
+
+		dbStructure.deleteOAuthClient(id)
+		return nil
+	})
+}
+
+func (s *DBStructure) deleteOAuthClient(id string) {
+	delete(s.OAuthClients, id)
+
+	now := time.Now().UTC()
+	for familyID, family := range s.TokenFamilies {
+		if family.ClientID == id {
+			s.revokeTokenFamily(familyID, now)
+		}
+	}
+	for codeHash, code := range s.AuthorizationCodes {
+		if code.ClientID == id {
+			delete(s.AuthorizationCodes, codeHash)
+		}
+	}
+	for key, consent := range s.OAuthConsents {
+		if consent.ClientID == id {
+			delete(s.OAuthConsents, key)
+		}
+	}
+}
+
+// CreateAuthorizationCode stores a code, pruning expired ones.
+func (db *DB) CreateAuthorizationCode(code AuthorizationCode) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		now := time.Now().UTC()
+		for codeHash, existing := range dbStructure.AuthorizationCodes {
+			if now.After(existing.ExpiresAt) {
+				delete(dbStructure.AuthorizationCodes, codeHash)
+			}
+		}
+
+		dbStructure.AuthorizationCodes[code.CodeHash] = code
+		return nil
+	})
+}
+
+// CodeExchange is the session an authorization code is exchanged for: its
+// first refresh token and the client holding it.
+type CodeExchange struct {
+	TokenHash string
+	ExpiresAt time.Time
+	Client    SessionClient
+}
+
+// RedeemAuthorizationCode exchanges a code for a new session in a single
+// write. exchange vets the unused code and the user it was issued to and
+// returns the session to create; if it fails, nothing is written and the
+// code stays unused. Unknown or expired codes return ErrTokenInvalid; a
+// code that was already used returns ErrTokenReused and revokes the session
+// it was exchanged for.
+func (db *DB) RedeemAuthorizationCode(codeHash string, now time.Time, exchange func(AuthorizationCode, User) (CodeExchange, error)) (AuthorizationCode, TokenFamily, error) {
+	var code AuthorizationCode
+	var family TokenFamily
+	reused := false
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		code, ok = dbStructure.AuthorizationCodes[codeHash]
+		if !ok || now.After(code.ExpiresAt) {
+			return ErrTokenInvalid
+		}
+
+		if !code.UsedAt.IsZero() {
+			reused = true
+			if code.FamilyID == "" || !dbStructure.revokeTokenFamily(code.FamilyID, now) {
+				return errNoChanges
+			}
+			return nil
+		}
+
+		user, ok := dbStructure.Users[code.UserID]
+		if !ok {
+			return ErrTokenInvalid
+		}
+		session, err := exchange(code, user)
+		if err != nil {
+			return err
+		}
+
+		family, err = dbStructure.createTokenFamily(code.UserID, session.ExpiresAt, session.Client)
+		if err != nil {
+			return err
+		}
+		dbStructure.addRefreshToken(session.TokenHash, family)
+
+		code.UsedAt = now
+		code.FamilyID = family.ID
+		dbStructure.AuthorizationCodes[codeHash] = code
+		return nil
+	})
+	if err != nil {
+		return AuthorizationCode{}, TokenFamily{}, err
+	}
+	if reused {
+		return AuthorizationCode{}, TokenFamily{}, ErrTokenReused
+	}
+
+	return code, family, nil
+}
+
+// GrantOAuthConsent adds scopes to what the user has granted the client.
+func (db *DB) GrantOAuthConsent(userID int, clientID string, scopes []string) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		key := consentKey(userID, clientID)
+		consent, ok := dbStructure.OAuthConsents[key]
+		if !ok {
+			consent = OAuthConsent{
+				UserID:   userID,
+				ClientID: clientID,
+			}
+		}
+		for _, scope := range scopes {
+			if !slices.Contains(consent.Scopes, scope) {
+				consent.Scopes = append(consent.Scopes, scope)
+			}
+		}
+		consent.GrantedAt = time.Now().UTC()
+		dbStructure.OAuthConsents[key] = consent
+		return nil
+	})
+}
+
+// HasOAuthConsent reports whether the user already granted the client every
+// one of scopes.
+func (db *DB) HasOAuthConsent(userID int, clientID string, scopes []string) (bool, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return false, err
+	}
+
+	consent, ok := dbStructure.OAuthConsents[consentKey(userID, clientID)]
+	if !ok {
+		return false, nil
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(consent.Scopes, scope) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
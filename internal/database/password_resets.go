@@ -0,0 +1,87 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrTokenInvalid = errors.New("token is invalid, used or expired")
+
+// PasswordReset is a single-use reset token. Only the token's hash is
+// stored.
+type PasswordReset struct {
+	TokenHash string    `json:"token_hash"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UsedAt    time.Time `json:"used_at"`
+}
+
+func (db *DB) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) (PasswordReset, error) {
+	var reset PasswordReset
+	err := db.update(func(dbStructure *DBStructure) error {
+		now := time.Now().UTC()
+		for hash, reset := range dbStructure.PasswordResets {
+			if now.After(reset.ExpiresAt) {
+				delete(dbStructure.PasswordResets, hash)
+			}
+		}
+
+		reset = PasswordReset{
+			TokenHash: tokenHash,
+			UserID:    userID,
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+		}
+		dbStructure.PasswordResets[tokenHash] = reset
+		return nil
+	})
+	if err != nil {
+		return PasswordReset{}, err
+	}
+
+	return reset, nil
+}
+
+// GetPasswordReset returns an outstanding reset token without spending it.
+func (db *DB) GetPasswordReset(tokenHash string, now time.Time) (PasswordReset, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return PasswordReset{}, err
+	}
+
+	reset, ok := dbStructure.PasswordResets[tokenHash]
+	if !ok || !reset.UsedAt.IsZero() || now.After(reset.ExpiresAt) {
+		return PasswordReset{}, ErrTokenInvalid
+	}
+
+	return reset, nil
+}
+
+// ResetPassword redeems a reset token, sets the new password hash and
+// revokes every token issued to the user in a single write. Every other
+// outstanding reset token of that user is spent as well.
+func (db *DB) ResetPassword(tokenHash, hashedPassword string, now time.Time) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		reset, ok := dbStructure.PasswordResets[tokenHash]
+		if !ok || !reset.UsedAt.IsZero() || now.After(reset.ExpiresAt) {
+			return ErrTokenInvalid
+		}
+		user, ok := dbStructure.Users[reset.UserID]
+		if !ok {
+			return ErrTokenInvalid
+		}
+
+		for hash, other := range dbStructure.PasswordResets {
+			if other.UserID == reset.UserID && other.UsedAt.IsZero() {
+				other.UsedAt = now
+				dbStructure.PasswordResets[hash] = other
+			}
+		}
+
+		user.HashedPassword = hashedPassword
+		user.TokensRevokedAt = now
+		dbStructure.Users[user.ID] = user
+		return nil
+	})
+}
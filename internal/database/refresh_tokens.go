@@ -0,0 +1,216 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTokenReused is returned when a refresh token that was already rotated
+// is presented again. The whole family is revoked when that happens.
+var ErrTokenReused = errors.New("refresh token was already used")
+
+// TokenFamily groups every refresh token descended from a single login. It
+// is what users see as a session.
+type TokenFamily struct {
+	ID         string `json:"id"`
+	UserID     int    `json:"user_id"`
+	DeviceName string `json:"device_name"`
+	IP         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	// ClientID and Scopes are set on sessions held by OAuth clients.
+	ClientID   string    `json:"client_id"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	RevokedAt  time.Time `json:"revoked_at"`
+}
+
+// Active reports whether the family can still be refreshed.
+func (f TokenFamily) Active(now time.Time) bool {
+	return f.RevokedAt.IsZero() && now.Before(f.ExpiresAt)
+}
+
+// SessionClient describes the device a refresh token was issued to, and
+// for OAuth sessions the client and the scopes it was granted.
+type SessionClient struct {
+	DeviceName string
+	IP         string
+	UserAgent  string
+	ClientID   string
+	Scopes     []string
+}
+
+// RefreshToken is a refresh token issued in a family, keyed by its hash.
+type RefreshToken struct {
+	TokenHash string    `json:"token_hash"`
+	FamilyID  string    `json:"family_id"`
+	UserID    int       `json:"user_id"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+// CreateTokenFamily starts a new family with its first refresh token.
+func (db *DB) CreateTokenFamily(userID int, tokenHash string, expiresAt time.Time, client SessionClient) (TokenFamily, error) {
+	var family TokenFamily
+	err := db.update(func(dbStructure *DBStructure) error {
+		var err error
+		family, err = dbStructure.createTokenFamily(userID, expiresAt, client)
+		if err != nil {
+			return err
+		}
+		dbStructure.addRefreshToken(tokenHash, family)
+		return nil
+	})
+	if err != nil {
+		return TokenFamily{}, err
+	}
+
+	return family, nil
+}
+
+func (s *DBStructure) createTokenFamily(userID int, expiresAt time.Time, client SessionClient) (TokenFamily, error) {
+	id, err := randomID()
+	if err != nil {
+		return TokenFamily{}, err
+	}
+
+	now := time.Now().UTC()
+	family := TokenFamily{
+		ID:         id,
+		UserID:     userID,
+		DeviceName: client.DeviceName,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		ClientID:   client.ClientID,
+		Scopes:     client.Scopes,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  expiresAt,
+	}
+	s.TokenFamilies[id] = family
+
+	return family, nil
+}
+
+// addRefreshToken records the first refresh token of a new family.
+func (s *DBStructure) addRefreshToken(tokenHash string, family TokenFamily) {
+	s.RefreshTokens[tokenHash] = RefreshToken{
+		TokenHash: tokenHash,
+		FamilyID:  family.ID,
+		UserID:    family.UserID,
+		IssuedAt:  family.CreatedAt,
+		ExpiresAt: family.ExpiresAt,
+	}
+}
+
+// RotateRefreshToken spends oldHash and issues newHash in the same family.
+// Presenting a token that was already rotated revokes the family and
+// returns ErrTokenReused; tokens of a revoked family return
+// ErrTokenInvalid. A legacy token, issued before rotation existed and
+// without a record, starts a new family on first use; any other token
+// without a record returns ErrTokenInvalid. The check and the rotation
+// happen in one update, so of two concurrent refreshes with the same token
+// only one succeeds.
+func (db *DB) RotateRefreshToken(oldHash, newHash string, userID int, legacy bool, expiresAt time.Time, client SessionClient) (RefreshToken, error) {
+	var token RefreshToken
+	reused := false
+	err := db.update(func(dbStructure *DBStructure) error {
+		now := time.Now().UTC()
+		old, ok := dbStructure.RefreshTokens[oldHash]
+		if !ok {
+			if !legacy {
+				return ErrTokenInvalid
+			}
+			family, err := dbStructure.createTokenFamily(userID, expiresAt, client)
+			if err != nil {
+				return err
+			}
+			old = RefreshToken{
+				TokenHash: oldHash,
+				FamilyID:  family.ID,
+				UserID:    userID,
+			}
+		}
+
+		if old.UserID != userID {
+			return ErrTokenInvalid
+		}
+
+		family, ok := dbStructure.TokenFamilies[old.FamilyID]
+		if !ok || !family.RevokedAt.IsZero() {
+			return ErrTokenInvalid
+		}
+
+		if !old.RotatedAt.IsZero() {
+			// The revocation has to be written, so this isn't returned
+			// as an error.
+			reused = true
+			family.RevokedAt = now
+			dbStructure.TokenFamilies[family.ID] = family
+			return nil
+		}
+
+		old.RotatedAt = now
+		dbStructure.RefreshTokens[oldHash] = old
+
+		family.IP = client.IP
+		family.UserAgent = client.UserAgent
+		family.LastUsedAt = now
+		family.ExpiresAt = expiresAt
+		dbStructure.TokenFamilies[family.ID] = family
+
+		token = RefreshToken{
+			TokenHash: newHash,
+			FamilyID:  family.ID,
+			UserID:    userID,
+			IssuedAt:  now,
+			ExpiresAt: expiresAt,
+		}
+		dbStructure.RefreshTokens[newHash] = token
+		return nil
+	})
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if reused {
+		return RefreshToken{}, ErrTokenReused
+	}
+
+	return token, nil
+}
+
+// RevokeTokenFamily revokes the family the token belongs to, if any.
+func (db *DB) RevokeTokenFamily(tokenHash string) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		token, ok := dbStructure.RefreshTokens[tokenHash]
+		if !ok || !dbStructure.revokeTokenFamily(token.FamilyID, time.Now().UTC()) {
+			return errNoChanges
+		}
+		return nil
+	})
+}
+
+func (s *DBStructure) revokeTokenFamily(id string, now time.Time) bool {
+	family, ok := s.TokenFamilies[id]
+	if !ok || !family.RevokedAt.IsZero() {
+		return false
+	}
+
+	family.RevokedAt = now
+	s.TokenFamilies[id] = family
+	return true
+}
+
+// isRefreshTokenRevoked reports whether the token belongs to a family that
+// was revoked.
+func (s *DBStructure) isRefreshTokenRevoked(tokenHash string) bool {
+	token, ok := s.RefreshTokens[tokenHash]
+	if !ok {
+		return false
+	}
+
+	family, ok := s.TokenFamilies[token.FamilyID]
+	return !ok || !family.RevokedAt.IsZero()
+}
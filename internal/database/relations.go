@@ -0,0 +1,126 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+type Block struct {
+	BlockerID int       `json:"blocker_id"`
+	BlockedID int       `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Mute struct {
+	MuterID   int       `json:"muter_id"`
+	MutedID   int       `json:"muted_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func relationKey(userID, targetID int) string {
+	return fmt.Sprintf("%d:%d", userID, targetID)
+}
+
+func (db *DB) BlockUser(blockerID, blockedID int) (Block, error) {
+	var block Block
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[blockedID]; !ok {
+			return ErrNotExist
+		}
+
+		key := relationKey(blockerID, blockedID)
+		var ok bool
+		if block, ok = dbStructure.Blocks[key]; ok {
+			return errNoChanges
+		}
+
+		block = Block{
+			BlockerID: blockerID,
+			BlockedID: blockedID,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.Blocks[key] = block
+		return nil
+	})
+	if err != nil {
+		return Block{}, err
+	}
+
+	return block, nil
+}
+
+func (db *DB) UnblockUser(blockerID, blockedID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		key := relationKey(blockerID, blockedID)
+		if _, ok := dbStructure.Blocks[key]; !ok {
+			return errNoChanges
+		}
+		delete(dbStructure.Blocks, key)
+		return nil
+	})
+}
+
+func (db *DB) MuteUser(muterID, mutedID int) (Mute, error) {
+	var mute Mute
+	err := db.update(func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[mutedID]; !ok {
+			return ErrNotExist
+		}
+
+		key := relationKey(muterID, mutedID)
+		var ok bool
+		if mute, ok = dbStructure.Mutes[key]; ok {
+			return errNoChanges
+		}
+
+		mute = Mute{
+			MuterID:   muterID,
+			MutedID:   mutedID,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.Mutes[key] = mute
+		return nil
+	})
+	if err != nil {
+		return Mute{}, err
+	}
+
+	return mute, nil
+}
+
+func (db *DB) UnmuteUser(muterID, mutedID int) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		key := relationKey(muterID, mutedID)
+		if _, ok := dbStructure.Mutes[key]; !ok {
+			return errNoChanges
+		}
+		delete(dbStructure.Mutes, key)
+		return nil
+	})
+}
+
+// GetFilteredAuthorIDs returns the users whose chirps viewerID must not
+// see: users blocked by or blocking the viewer, and users the viewer muted.
+func (db *DB) GetFilteredAuthorIDs(viewerID int) (map[int]struct{}, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[int]struct{}{}
+	for _, block := range dbStructure.Blocks {
+		if block.BlockerID == viewerID {
+			ids[block.BlockedID] = struct{}{}
+		}
+		if block.BlockedID == viewerID {
+			ids[block.BlockerID] = struct{}{}
+		}
+	}
+	for _, mute := range dbStructure.Mutes {
+		if mute.MuterID == viewerID {
+			ids[mute.MutedID] = struct{}{}
+		}
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrReportClosed is returned when acting on a report that was
+	// already resolved or dismissed.
+	ErrReportClosed = errors.New("report is already closed")
+	// ErrActionNotApplicable is returned for an action that can't be taken
+	// on the report's target, such as hiding a user.
+	ErrActionNotApplicable = errors.New("action doesn't apply to the report")
+)
+
+type ReportTarget string
+
+const (
+	ReportTargetChirp ReportTarget = "chirp"
+	ReportTargetUser  ReportTarget = "user"
+)
+
+type ReportReason string
+
+const (
+	ReportReasonSpam          ReportReason = "spam"
+	ReportReasonHarassment    ReportReason = "harassment"
+	ReportReasonHate          ReportReason = "hate"
+	ReportReasonViolence      ReportReason = "violence"
+	ReportReasonSexual        ReportReason = "sexual"
+	ReportReasonImpersonation ReportReason = "impersonation"
+	ReportReasonOther         ReportReason = "other"
+	ReportReasonAutomatedFlag ReportReason = "automated_flag"
+)
+
+type ReportStatus string
+
+const (
+	ReportStatusOpen      ReportStatus = "open"
+	ReportStatusResolved  ReportStatus = "resolved"
+	ReportStatusDismissed ReportStatus = "dismissed"
+)
+
+type Report struct {
+	ID         int          `json:"id"`
+	ReporterID int          `json:"reporter_id"`
+	TargetType ReportTarget `json:"target_type"`
+	TargetID   int          `json:"target_id"`
+	Reason     ReportReason `json:"reason"`
+	Details    string       `json:"details"`
+	Status     ReportStatus `json:"status"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ResolvedAt time.Time    `json:"resolved_at"`
+	ResolvedBy string       `json:"resolved_by"`
+}
+
+func IsValidReportReason(reason ReportReason) bool {
+	switch reason {
+	case ReportReasonSpam,
+		ReportReasonHarassment,
+		ReportReasonHate,
+		ReportReasonViolence,
+		ReportReasonSexual,
+		ReportReasonImpersonation,
+		ReportReasonOther:
+		return true
+	}
+	return false
+}
+
+// CreateReport files a report. A reporter can only have one open report per
+// target; a reporter ID of 0 is used for reports raised automatically.
+func (db *DB) CreateReport(reporterID int, targetType ReportTarget, targetID int, reason ReportReason, details string) (Report, error) {
+	var report Report
+	err := db.update(func(dbStructure *DBStructure) error {
+		for _, other := range dbStructure.Reports {
+			if other.ReporterID == reporterID &&
+				other.TargetType == targetType &&
+				other.TargetID == targetID &&
+				other.Status == ReportStatusOpen {
+				return ErrAlreadyExists
+			}
+		}
+
+		report = dbStructure.addReport(reporterID, targetType, targetID, reason, details, time.Now().UTC())
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+func (s *DBStructure) addReport(reporterID int, targetType ReportTarget, targetID int, reason ReportReason, details string, now time.Time) Report {
+	id := nextID(s.Reports)
+	report := Report{
+		ID:         id,
+		ReporterID: reporterID,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Reason:     reason,
+		Details:    details,
+		Status:     ReportStatusOpen,
+		CreatedAt:  now,
+	}
+	s.Reports[id] = report
+	return report
+}
+
+// GetReportsByStatus returns reports with the given status, oldest first. An
+// empty status returns every report.
+func (db *DB) GetReportsByStatus(status ReportStatus) ([]Report, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]Report, 0)
+	for _, report := range dbStructure.Reports {
+		if status == "" || report.Status == status {
+			reports = append(reports, report)
+		}
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].ID < reports[j].ID
+	})
+
+	return reports, nil
+}
+
+// ActOnReport takes a moderation action on an open report, closes it and
+// records the action in the audit log in a single write, so a report can
+// only be acted on once. Dismissing a report releases a held chirp.
+func (db *DB) ActOnReport(id int, actionType ModerationActionType, moderator, note string) (Report, error) {
+	var report Report
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		report, ok = dbStructure.Reports[id]
+		if !ok {
+			return ErrNotExist
+		}
+		if report.Status != ReportStatusOpen {
+			return ErrReportClosed
+		}
+
+		status := ReportStatusResolved
+		switch actionType {
+		case ModerationActionHideChirp:
+			if report.TargetType != ReportTargetChirp {
+				return ErrActionNotApplicable
+			}
+			chirp, ok := dbStructure.Chirps[report.TargetID]
+			if !ok {
+				return ErrNotExist
+			}
+			chirp.Hidden = true
+			dbStructure.Chirps[chirp.ID] = chirp
+		case ModerationActionSuspendUser:
+			userID := report.TargetID
+			if report.TargetType == ReportTargetChirp {
+				chirp, ok := dbStructure.Chirps[report.TargetID]
+				if !ok {
+					return ErrNotExist
+				}
+				userID = chirp.AuthorID
+			}
+			user, ok := dbStructure.Users[userID]
+			if !ok {
+				return ErrNotExist
+			}
+			user.State = AccountStateSuspended
+			user.StateExpiresAt = time.Time{}
+			dbStructure.Users[userID] = user
+		case ModerationActionDismiss:
+			status = ReportStatusDismissed
+			if chirp, ok := dbStructure.Chirps[report.TargetID]; ok && report.TargetType == ReportTargetChirp && chirp.Held {
+				chirp.Held = false
+				dbStructure.Chirps[chirp.ID] = chirp
+			}
+		default:
+			return ErrActionNotApplicable
+		}
+
+		now := time.Now().UTC()
+		report.Status = status
+		report.ResolvedAt = now
+		report.ResolvedBy = moderator
+		dbStructure.Reports[id] = report
+
+		dbStructure.logModerationAction(ModerationAction{
+			Moderator:  moderator,
+			Action:     actionType,
+			ReportID:   report.ID,
+			TargetType: report.TargetType,
+			TargetID:   report.TargetID,
+			Note:       note,
+		}, now)
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
@@ -1,41 +1,59 @@
 package database
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"time"
 )
 
-type Revocation struct {
-	Token     string    `json:"token"`
-	RevokedAt time.Time `json:"revoked_at"`
-}
+// legacyRevocationTTL bounds how long revocations written before expiries
+// were recorded are kept. It matches the longest refresh token lifetime
+// issued at the time.
+const legacyRevocationTTL = time.Hour * 24 * 30 * 6
 
-func (db *DB) RevokeToken(token string) error {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
-	}
+// revocationLeeway keeps records past their expiry for as long as token
+// validation still accepts an expired token. It matches the JWT leeway.
+const revocationLeeway = 30 * time.Second
 
-	revocation := Revocation{
-		Token:     token,
-		RevokedAt: time.Now().UTC(),
-	}
-	dbStructure.Revocations[token] = revocation
+// Revocation records a revoked token by its hash. It only needs to outlive
+// the token itself, so it is dropped once ExpiresAt plus the validation
+// leeway has passed.
+type Revocation struct {
+	TokenHash string    `json:"token_hash"`
+	UserID    int       `json:"user_id"`
+	RevokedAt time.Time `json:"revoked_at"`
+	ExpiresAt time.Time `json:"expires_at"`
 
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return err
-	}
+	// Token holds the plaintext token in databases written by older
+	// versions. migrateRevocations rekeys those entries by hash.
+	Token string `json:"token,omitempty"`
+}
 
-	return nil
+func (db *DB) RevokeToken(tokenHash string, userID int, expiresAt time.Time) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		dbStructure.Revocations[tokenHash] = Revocation{
+			TokenHash: tokenHash,
+			UserID:    userID,
+			RevokedAt: time.Now().UTC(),
+			ExpiresAt: expiresAt,
+		}
+		return nil
+	})
 }
 
-func (db *DB) IsTokenRevoked(token string) (bool, error) {
+// IsTokenRevoked reports whether the token was revoked directly or belongs
+// to a session that was.
+func (db *DB) IsTokenRevoked(tokenHash string) (bool, error) {
 	dbStructure, err := db.loadDB()
 	if err != nil {
 		return false, err
 	}
 
-	revocation, ok := dbStructure.Revocations[token]
+	if dbStructure.isRefreshTokenRevoked(tokenHash) {
+		return true, nil
+	}
+
+	revocation, ok := dbStructure.Revocations[tokenHash]
 	if !ok {
 		return false, nil
 	}
@@ -46,3 +64,63 @@ func (db *DB) IsTokenRevoked(token string) (bool, error) {
 
 	return true, nil
 }
+
+// PurgeExpiredTokens drops revocations and refresh token records whose
+// tokens have expired, along with expired sessions. Records are kept until
+// the validation leeway has passed as well. It returns how many entries were
+// removed.
+func (db *DB) PurgeExpiredTokens(now time.Time) (int, error) {
+	cutoff := now.Add(-revocationLeeway)
+	purged := 0
+	err := db.update(func(dbStructure *DBStructure) error {
+		for tokenHash, revocation := range dbStructure.Revocations {
+			if !cutoff.Before(revocation.ExpiresAt) {
+				delete(dbStructure.Revocations, tokenHash)
+				purged++
+			}
+		}
+		for tokenHash, token := range dbStructure.RefreshTokens {
+			if !cutoff.Before(token.ExpiresAt) {
+				delete(dbStructure.RefreshTokens, tokenHash)
+				purged++
+			}
+		}
+		for id, family := range dbStructure.TokenFamilies {
+			if !cutoff.Before(family.ExpiresAt) {
+				delete(dbStructure.TokenFamilies, id)
+				purged++
+			}
+		}
+
+		if purged == 0 {
+			return errNoChanges
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// migrateRevocations rekeys revocations stored under plaintext tokens by
+// older versions.
+func (s *DBStructure) migrateRevocations() {
+	for key, revocation := range s.Revocations {
+		if revocation.Token == "" {
+			continue
+		}
+		delete(s.Revocations, key)
+		revocation.TokenHash = hashToken(revocation.Token)
+		revocation.Token = ""
+		revocation.ExpiresAt = revocation.RevokedAt.Add(legacyRevocationTTL)
+		s.Revocations[revocation.TokenHash] = revocation
+	}
+}
+
+// hashToken matches auth.HashToken, which tokens are stored under.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// GetSessions returns the user's active sessions, most recently used first.
+func (db *DB) GetSessions(userID int) ([]TokenFamily, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	sessions := []TokenFamily{}
+	for _, family := range dbStructure.TokenFamilies {
+		if family.UserID == userID && family.Active(now) {
+			sessions = append(sessions, family)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+
+	return sessions, nil
+}
+
+// GetSession returns a session by ID, whether or not it is still active.
+func (db *DB) GetSession(id string) (TokenFamily, error) {
+	dbStructure, err := db.loadDB()
+	if err != nil {
+		return TokenFamily{}, err
+	}
+
+	family, ok := dbStructure.TokenFamilies[id]
+	if !ok {
+		return TokenFamily{}, ErrNotExist
+	}
+
+	return family, nil
+}
+
+// RevokeSession revokes one of the user's sessions. Sessions belonging to
+// someone else return ErrNotExist.
+func (db *DB) RevokeSession(userID int, id string) error {
+	return db.update(func(dbStructure *DBStructure) error {
+		family, ok := dbStructure.TokenFamilies[id]
+		if !ok || family.UserID != userID {
+			return ErrNotExist
+		}
+
+		if !dbStructure.revokeTokenFamily(id, time.Now().UTC()) {
+			return errNoChanges
+		}
+		return nil
+	})
+}
+
+// RevokeAllSessions revokes every session of the user and invalidates the
+// access tokens issued so far.
+func (db *DB) RevokeAllSessions(userID int) error {
+	_, err := db.updateUser(userID, func(dbStructure *DBStructure, user *User) error {
+		now := time.Now().UTC()
+		for id, family := range dbStructure.TokenFamilies {
+			if family.UserID == userID {
+				dbStructure.revokeTokenFamily(id, now)
+			}
+		}
+
+		user.TokensRevokedAt = now
+		return nil
+	})
+	return err
+}
@@ -1,35 +1,127 @@
 package database
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type AccountState string
+
+const (
+	AccountStateActive       AccountState = "active"
+	AccountStateSuspended    AccountState = "suspended"
+	AccountStateShadowbanned AccountState = "shadowbanned"
+)
 
 type User struct {
-	ID             int    `json:"id"`
-	Email          string `json:"email"`
-	HashedPassword string `json:"hashed_password"`
-	IsChirpyRed    bool   `json:"is_chirpy_red"`
+	ID             int          `json:"id"`
+	Email          string       `json:"email"`
+	HashedPassword string       `json:"hashed_password"`
+	IsChirpyRed    bool         `json:"is_chirpy_red"`
+	State          AccountState `json:"state"`
+	StateExpiresAt time.Time    `json:"state_expires_at"`
+	CreatedAt      time.Time    `json:"created_at"`
+	Handle         string       `json:"handle"`
+	DisplayName    string       `json:"display_name"`
+	Bio            string       `json:"bio"`
+	AvatarURL      string       `json:"avatar_url"`
+	EmailVerified  bool         `json:"email_verified"`
+	// TokensRevokedAt invalidates every token issued before it.
+	TokensRevokedAt time.Time `json:"tokens_revoked_at"`
+	// DeletionScheduledFor is set while the account is in its deletion
+	// grace period. DeletionRequestedBy names the moderator who scheduled
+	// it and is empty when the user asked for it themselves.
+	DeletionScheduledFor time.Time `json:"deletion_scheduled_for"`
+	DeletionRequestedBy  string    `json:"deletion_requested_by"`
+	// MFASecret is the sealed TOTP secret once two-factor authentication
+	// is enabled; MFAPendingSecret holds it during enrollment.
+	MFASecret        string `json:"mfa_secret"`
+	MFAPendingSecret string `json:"mfa_pending_secret"`
+	// MFALastStep is the last TOTP period a code was accepted for, so a
+	// code can't be replayed.
+	MFALastStep int64 `json:"mfa_last_step"`
+	// RecoveryCodeHashes are the unused recovery codes, hashed.
+	RecoveryCodeHashes []string `json:"recovery_code_hashes"`
 }
 
-var ErrAlreadyExists = errors.New("already exists")
+type Profile struct {
+	Handle      string
+	DisplayName string
+	Bio         string
+	AvatarURL   string
+}
 
-func (db *DB) CreateUser(email, hashedPassword string) (User, error) {
-	if _, err := db.GetUserByEmail(email); !errors.Is(err, ErrNotExist) {
-		return User{}, ErrAlreadyExists
+func IsValidAccountState(state AccountState) bool {
+	switch state {
+	case AccountStateActive, AccountStateSuspended, AccountStateShadowbanned:
+		return true
 	}
+	return false
+}
 
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
+// TokenRevoked reports whether a token issued at issuedAt has been revoked
+// through TokensRevokedAt. JWT timestamps have second precision.
+func (u User) TokenRevoked(issuedAt time.Time) bool {
+	return issuedAt.Before(u.TokensRevokedAt.Truncate(time.Second))
+}
+
+// MFAEnabled -
+func (u User) MFAEnabled() bool {
+	return u.MFASecret != ""
+}
+
+// PendingDeletion -
+func (u User) PendingDeletion() bool {
+	return !u.DeletionScheduledFor.IsZero()
+}
 
-	id := len(dbStructure.Users) + 1
-	user := User{
-		ID:             id,
-		Email:          email,
-		HashedPassword: hashedPassword,
+// DeletionCancellable reports whether the user may cancel their pending
+// deletion, which they can't when a moderator scheduled it.
+func (u User) DeletionCancellable() bool {
+	return u.DeletionRequestedBy == ""
+}
+
+// EffectiveState returns the user's account state at now, treating an
+// expired restriction as active. A zero StateExpiresAt never expires.
+func (u User) EffectiveState(now time.Time) AccountState {
+	if u.State == "" {
+		return AccountStateActive
+	}
+	if u.State != AccountStateActive && !u.StateExpiresAt.IsZero() && now.After(u.StateExpiresAt) {
+		return AccountStateActive
 	}
-	dbStructure.Users[id] = user
+	return u.State
+}
 
-	err = db.writeDB(dbStructure)
+var ErrAlreadyExists = errors.New("already exists")
+
+// ErrHandleTaken and ErrEmailTaken tell which field of an update conflicts
+// with another user. Both match ErrAlreadyExists.
+var (
+	ErrHandleTaken = fmt.Errorf("handle %w", ErrAlreadyExists)
+	ErrEmailTaken  = fmt.Errorf("email %w", ErrAlreadyExists)
+)
+
+func (db *DB) CreateUser(email, hashedPassword string) (User, error) {
+	var user User
+	err := db.update(func(dbStructure *DBStructure) error {
+		if dbStructure.emailTaken(0, email) {
+			return ErrEmailTaken
+		}
+
+		id := nextID(dbStructure.Users)
+		user = User{
+			ID:             id,
+			Email:          email,
+			HashedPassword: hashedPassword,
+			State:          AccountStateActive,
+			CreatedAt:      time.Now().UTC(),
+		}
+		dbStructure.Users[id] = user
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
@@ -58,7 +150,7 @@ func (db *DB) GetUserByEmail(email string) (User, error) {
 	}
 
 	for _, user := range dbStructure.Users {
-		if user.Email == email {
+		if strings.EqualFold(user.Email, email) {
 			return user, nil
 		}
 	}
@@ -66,44 +158,170 @@ func (db *DB) GetUserByEmail(email string) (User, error) {
 	return User{}, ErrNotExist
 }
 
-func (db *DB) UpdateUser(id int, email, hashedPassword string) (User, error) {
+// GetUserByHandle looks a user up by handle, ignoring case.
+func (db *DB) GetUserByHandle(handle string) (User, error) {
 	dbStructure, err := db.loadDB()
 	if err != nil {
 		return User{}, err
 	}
 
-	user, ok := dbStructure.Users[id]
-	if !ok {
-		return User{}, ErrNotExist
+	for _, user := range dbStructure.Users {
+		if user.Handle != "" && strings.EqualFold(user.Handle, handle) {
+			return user, nil
+		}
 	}
 
+	return User{}, ErrNotExist
+}
+
+// UpdateAccount replaces a user's credentials and public profile in one
+// write. Both the handle and the email are checked before anything changes,
+// returning ErrHandleTaken or ErrEmailTaken if another user holds them in
+// any case. Changing the email marks it as unverified.
+func (db *DB) UpdateAccount(id int, email, hashedPassword string, profile Profile) (User, error) {
+	return db.updateUser(id, func(dbStructure *DBStructure, user *User) error {
+		if user.Handle != profile.Handle && dbStructure.handleTaken(id, profile.Handle) {
+			return ErrHandleTaken
+		}
+		if user.Email != email && dbStructure.emailTaken(id, email) {
+			return ErrEmailTaken
+		}
+
+		setCredentials(user, email, hashedPassword)
+		user.Handle = profile.Handle
+		user.DisplayName = profile.DisplayName
+		user.Bio = profile.Bio
+		user.AvatarURL = profile.AvatarURL
+		return nil
+	})
+}
+
+// UpdateUser replaces a user's credentials. Changing the email marks it as
+// unverified.
+func (db *DB) UpdateUser(id int, email, hashedPassword string) (User, error) {
+	return db.updateUser(id, func(dbStructure *DBStructure, user *User) error {
+		if user.Email != email && dbStructure.emailTaken(id, email) {
+			return ErrEmailTaken
+		}
+
+		setCredentials(user, email, hashedPassword)
+		return nil
+	})
+}
+
+func setCredentials(user *User, email, hashedPassword string) {
+	if user.Email != email {
+		user.EmailVerified = false
+	}
 	user.Email = email
 	user.HashedPassword = hashedPassword
-	dbStructure.Users[id] = user
+}
 
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return User{}, err
+// handleTaken reports whether a user other than id holds handle.
+func (s *DBStructure) handleTaken(id int, handle string) bool {
+	if handle == "" {
+		return false
+	}
+	for _, other := range s.Users {
+		if other.ID != id && strings.EqualFold(other.Handle, handle) {
+			return true
+		}
 	}
+	return false
+}
 
-	return user, nil
+// emailTaken reports whether a user other than id holds email.
+func (s *DBStructure) emailTaken(id int, email string) bool {
+	for _, other := range s.Users {
+		if other.ID != id && strings.EqualFold(other.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// RehashPassword swaps a user's password hash for newHash, an equivalent
+// hash of the same password. It does nothing if the password was changed
+// since oldHash was read.
+func (db *DB) RehashPassword(id int, oldHash, newHash string) error {
+	_, err := db.updateUser(id, func(dbStructure *DBStructure, user *User) error {
+		if user.HashedPassword != oldHash {
+			return errNoChanges
+		}
+		user.HashedPassword = newHash
+		return nil
+	})
+	return err
 }
 
 func (db *DB) UpgradedUser(id int) (User, error) {
+	return db.updateUser(id, func(dbStructure *DBStructure, user *User) error {
+		user.IsChirpyRed = true
+		return nil
+	})
+}
+
+// SetUserState changes a user's account state. expiresAt is ignored for the
+// active state.
+func (db *DB) SetUserState(id int, state AccountState, expiresAt time.Time) (User, error) {
+	return db.updateUser(id, func(dbStructure *DBStructure, user *User) error {
+		user.State = state
+		user.StateExpiresAt = time.Time{}
+		if state != AccountStateActive {
+			user.StateExpiresAt = expiresAt
+		}
+		return nil
+	})
+}
+
+// GetUserIDsByState returns the IDs of users whose effective state at now
+// is state.
+func (db *DB) GetUserIDsByState(state AccountState, now time.Time) (map[int]struct{}, error) {
 	dbStructure, err := db.loadDB()
 	if err != nil {
-		return User{}, err
+		return nil, err
 	}
 
-	user, ok := dbStructure.Users[id]
-	if !ok {
-		return User{}, ErrNotExist
+	ids := map[int]struct{}{}
+	for _, user := range dbStructure.Users {
+		if user.EffectiveState(now) == state {
+			ids[user.ID] = struct{}{}
+		}
 	}
 
-	user.IsChirpyRed = true
-	dbStructure.Users[id] = user
+	return ids, nil
+}
 
-	err = db.writeDB(dbStructure)
+// VerifyUserEmail marks the user's email as verified, provided it is still
+// the address the verification was issued for.
+func (db *DB) VerifyUserEmail(id int, email string) (User, error) {
+	return db.updateUser(id, func(dbStructure *DBStructure, user *User) error {
+		if user.Email != email {
+			return ErrNotExist
+		}
+		user.EmailVerified = true
+		return nil
+	})
+}
+
+// updateUser applies fn to a user and returns the result. fn also gets the
+// rest of the database for uniqueness checks.
+func (db *DB) updateUser(id int, fn func(*DBStructure, *User) error) (User, error) {
+	var user User
+	err := db.update(func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[id]
+		if !ok {
+			return ErrNotExist
+		}
+
+		err := fn(dbStructure, &user)
+		if err != nil {
+			return err
+		}
+		dbStructure.Users[id] = user
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
@@ -0,0 +1,316 @@
+package profanity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Action -
+type Action string
+
+const (
+	// ActionMask -
+	ActionMask Action = "mask"
+	// ActionReject -
+	ActionReject Action = "reject"
+	// ActionFlag -
+	ActionFlag Action = "flag"
+)
+
+const mask = "****"
+
+// ErrInvalidRule -
+var ErrInvalidRule = errors.New("invalid rule")
+
+// Rule -
+type Rule struct {
+	Word   string `json:"word"`
+	Action Action `json:"action"`
+}
+
+// Result -
+type Result struct {
+	Cleaned  string
+	Rejected bool
+	Flagged  bool
+	Matches  []string
+}
+
+// Filter holds the active word list. It is safe for concurrent use and its
+// rules can be swapped at any time.
+type Filter struct {
+	mu    *sync.RWMutex
+	rules []Rule
+	index map[string][]indexedRule
+}
+
+// indexedRule is a rule as Check compares words against it. Rules are
+// indexed by their letters with repeats collapsed.
+type indexedRule struct {
+	word   foldedWord
+	action Action
+}
+
+// NewFilter -
+func NewFilter(rules []Rule) (*Filter, error) {
+	f := &Filter{
+		mu: &sync.RWMutex{},
+	}
+	err := f.SetRules(rules)
+	return f, err
+}
+
+// DefaultRules -
+func DefaultRules() []Rule {
+	return []Rule{
+		{Word: "kerfuffle", Action: ActionMask},
+		{Word: "sharbert", Action: ActionMask},
+		{Word: "fornax", Action: ActionMask},
+	}
+}
+
+// Rules -
+func (f *Filter) Rules() []Rule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	rules := make([]Rule, len(f.rules))
+	copy(rules, f.rules)
+	return rules
+}
+
+// SetRules validates and replaces the active rules. Rules for the same
+// word are merged, keeping the most severe action.
+func (f *Filter) SetRules(rules []Rule) error {
+	stored := make([]Rule, 0, len(rules))
+	folded := make([]foldedWord, 0, len(rules))
+	positions := make(map[string]int, len(rules))
+	for _, rule := range rules {
+		if rule.Action == "" {
+			rule.Action = ActionMask
+		}
+		if rule.Action != ActionMask && rule.Action != ActionReject && rule.Action != ActionFlag {
+			return fmt.Errorf("%w: unknown action %q for %q", ErrInvalidRule, rule.Action, rule.Word)
+		}
+		word := fold(rule.Word)
+		if word.letters == "" {
+			return fmt.Errorf("%w: empty word", ErrInvalidRule)
+		}
+
+		if i, ok := positions[word.String()]; ok {
+			if severity(rule.Action) > severity(stored[i].Action) {
+				stored[i] = rule
+			}
+			continue
+		}
+		positions[word.String()] = len(stored)
+		stored = append(stored, rule)
+		folded = append(folded, word)
+	}
+
+	index := make(map[string][]indexedRule, len(stored))
+	for i, rule := range stored {
+		word := folded[i]
+		index[word.letters] = append(index[word.letters], indexedRule{word: word, action: rule.Action})
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = stored
+	f.index = index
+	return nil
+}
+
+// LoadFile replaces the active rules with the JSON rule list at path.
+func (f *Filter) LoadFile(path string) error {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	rules := []Rule{}
+	err = json.Unmarshal(dat, &rules)
+	if err != nil {
+		return err
+	}
+
+	return f.SetRules(rules)
+}
+
+// SaveFile writes the active rules to path as JSON.
+func (f *Filter) SaveFile(path string) error {
+	dat, err := json.MarshalIndent(f.Rules(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, dat, 0600)
+}
+
+// Check masks, flags or rejects body according to the active rules. Words
+// are matched regardless of case, surrounding punctuation, diacritics,
+// common character substitutions and letters repeated more often.
+func (f *Filter) Check(body string) Result {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	result := Result{}
+	var b strings.Builder
+	runes := []rune(body)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		i = j
+
+		action, ok := f.match(fold(word))
+		if !ok {
+			b.WriteString(word)
+			continue
+		}
+
+		result.Matches = append(result.Matches, word)
+		switch action {
+		case ActionReject:
+			result.Rejected = true
+			b.WriteString(mask)
+		case ActionFlag:
+			result.Flagged = true
+			b.WriteString(word)
+		default:
+			b.WriteString(mask)
+		}
+	}
+
+	result.Cleaned = b.String()
+	return result
+}
+
+// match returns the most severe action of the rules word matches. A word
+// matches a rule if it spells the rule's word with letters repeated at
+// least as often, so "heeeck" matches "heck" but "as" doesn't match "ass".
+func (f *Filter) match(word foldedWord) (Action, bool) {
+	var action Action
+	found := false
+	for _, rule := range f.index[word.letters] {
+		if !word.covers(rule.word) {
+			continue
+		}
+		if !found || severity(rule.action) > severity(action) {
+			action = rule.action
+			found = true
+		}
+	}
+	return action, found
+}
+
+func severity(a Action) int {
+	switch a {
+	case ActionReject:
+		return 2
+	case ActionFlag:
+		return 1
+	default:
+		return 0
+	}
+}
+
+var substitutions = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'|': 'i',
+	'3': 'e',
+	'4': 'a',
+	'@': 'a',
+	'5': 's',
+	'$': 's',
+	'7': 't',
+	'+': 't',
+	'8': 'b',
+	'9': 'g',
+}
+
+// isWordRune reports whether r can be part of a word, including the symbols
+// commonly substituted for letters.
+func isWordRune(r rune) bool {
+	if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+		return true
+	}
+	switch r {
+	case '@', '$', '+', '|':
+		return true
+	}
+	return false
+}
+
+// foldedWord is a word in the form rules are compared in: lower case,
+// without diacritics or substitutions, as runs of the same letter. letters
+// holds one letter per run and runs how often it is repeated.
+type foldedWord struct {
+	letters string
+	runs    []int
+}
+
+func fold(word string) foldedWord {
+	var letters strings.Builder
+	runs := []int{}
+	var last rune
+	for _, r := range norm.NFD.String(strings.ToLower(strings.TrimSpace(word))) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if sub, ok := substitutions[r]; ok {
+			r = sub
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			continue
+		}
+		if r == last {
+			runs[len(runs)-1]++
+			continue
+		}
+		letters.WriteRune(r)
+		runs = append(runs, 1)
+		last = r
+	}
+	return foldedWord{letters: letters.String(), runs: runs}
+}
+
+// String spells the word out with its repeats.
+func (w foldedWord) String() string {
+	var b strings.Builder
+	i := 0
+	for _, r := range w.letters {
+		b.WriteString(strings.Repeat(string(r), w.runs[i]))
+		i++
+	}
+	return b.String()
+}
+
+// covers reports whether w spells rule with every letter repeated at least
+// as often as in rule. Both must have the same letters.
+func (w foldedWord) covers(rule foldedWord) bool {
+	if w.letters != rule.letters || len(w.runs) != len(rule.runs) {
+		return false
+	}
+	for i, n := range rule.runs {
+		if w.runs[i] < n {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package profanity
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFilterCheck(t *testing.T) {
+	filter, err := NewFilter([]Rule{
+		{Word: "kerfuffle", Action: ActionMask},
+		{Word: "ass", Action: ActionMask},
+		{Word: "butt", Action: ActionMask},
+		{Word: "fornax", Action: ActionReject},
+		{Word: "heck", Action: ActionFlag},
+		{Word: "sharbert", Action: ActionMask},
+		{Word: "sharbert", Action: ActionReject},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want Result
+	}{
+		{
+			name: "no match",
+			body: "hello world",
+			want: Result{Cleaned: "hello world"},
+		},
+		{
+			name: "mask",
+			body: "what a kerfuffle",
+			want: Result{Cleaned: "what a ****", Matches: []string{"kerfuffle"}},
+		},
+		{
+			name: "case and punctuation",
+			body: "Kerfuffle!",
+			want: Result{Cleaned: "****!", Matches: []string{"Kerfuffle"}},
+		},
+		{
+			name: "substitutions",
+			body: "k3rfuffl3",
+			want: Result{Cleaned: "****", Matches: []string{"k3rfuffl3"}},
+		},
+		{
+			name: "diacritics",
+			body: "kérfüffle",
+			want: Result{Cleaned: "****", Matches: []string{"kérfüffle"}},
+		},
+		{
+			name: "repeated letters",
+			body: "kerfuuuffle",
+			want: Result{Cleaned: "****", Matches: []string{"kerfuuuffle"}},
+		},
+		{
+			name: "fewer repeats than the rule",
+			body: "as but kerfufle",
+			want: Result{Cleaned: "as but kerfufle"},
+		},
+		{
+			name: "more repeats than the rule",
+			body: "asss buttt",
+			want: Result{Cleaned: "**** ****", Matches: []string{"asss", "buttt"}},
+		},
+		{
+			name: "part of a longer word",
+			body: "assess buttress",
+			want: Result{Cleaned: "assess buttress"},
+		},
+		{
+			name: "reject",
+			body: "by fornax",
+			want: Result{Cleaned: "by ****", Rejected: true, Matches: []string{"fornax"}},
+		},
+		{
+			name: "flag",
+			body: "oh heeeck",
+			want: Result{Cleaned: "oh heeeck", Flagged: true, Matches: []string{"heeeck"}},
+		},
+		{
+			name: "duplicate rule keeps the most severe action",
+			body: "sharbert",
+			want: Result{Cleaned: "****", Rejected: true, Matches: []string{"sharbert"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := filter.Check(tc.body)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Check(%q) = %+v, want %+v", tc.body, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFilterSetRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []Rule
+		want    []Rule
+		wantErr error
+	}{
+		{
+			name:  "default action",
+			rules: []Rule{{Word: "heck"}},
+			want:  []Rule{{Word: "heck", Action: ActionMask}},
+		},
+		{
+			name: "duplicates keep the most severe",
+			rules: []Rule{
+				{Word: "heck", Action: ActionFlag},
+				{Word: "HECK", Action: ActionReject},
+				{Word: "h3ck", Action: ActionMask},
+			},
+			want: []Rule{{Word: "HECK", Action: ActionReject}},
+		},
+		{
+			name: "different repeats are different words",
+			rules: []Rule{
+				{Word: "as", Action: ActionFlag},
+				{Word: "ass", Action: ActionMask},
+			},
+			want: []Rule{
+				{Word: "as", Action: ActionFlag},
+				{Word: "ass", Action: ActionMask},
+			},
+		},
+		{
+			name:    "unknown action",
+			rules:   []Rule{{Word: "heck", Action: "shout"}},
+			wantErr: ErrInvalidRule,
+		},
+		{
+			name:    "empty word",
+			rules:   []Rule{{Word: " !! ", Action: ActionMask}},
+			wantErr: ErrInvalidRule,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := NewFilter(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = filter.SetRules(tc.rules)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("SetRules() error = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := filter.Rules(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Rules() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
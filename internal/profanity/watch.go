@@ -0,0 +1,41 @@
+package profanity
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// Watch reloads the rules from path whenever its modification time changes,
+// polling every interval until ctx is cancelled. A file that fails to parse
+// is logged and the previous rules stay active.
+func (f *Filter) Watch(ctx context.Context, path string, interval time.Duration) {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil || !info.ModTime().After(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+
+			err = f.LoadFile(path)
+			if err != nil {
+				log.Printf("Couldn't reload profanity rules from %s: %s", path, err)
+				continue
+			}
+			log.Printf("Reloaded profanity rules from %s", path)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package spam
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/unfurl"
+)
+
+// DuplicateCheck compares a chirp against the author's recent chirps using
+// simhash, so copies with small edits are caught as well as exact repeats.
+type DuplicateCheck struct {
+	Window      time.Duration
+	MaxDistance int
+}
+
+// Name -
+func (c DuplicateCheck) Name() string {
+	return "duplicate"
+}
+
+// Score -
+func (c DuplicateCheck) Score(in Input) (float64, string) {
+	normalized := normalize(in.Body)
+	hash := simhash(normalized)
+
+	exact, near := 0, 0
+	for _, recent := range in.Recent {
+		if in.Now.Sub(recent.CreatedAt) > c.Window {
+			continue
+		}
+		other := normalize(recent.Body)
+		switch {
+		case other == normalized:
+			exact++
+		case hammingDistance(hash, simhash(other)) <= c.MaxDistance:
+			near++
+		}
+	}
+
+	switch {
+	case exact > 0:
+		return 1.0, fmt.Sprintf("identical to %d recent chirps", exact)
+	case near > 1:
+		return 0.8, fmt.Sprintf("similar to %d recent chirps", near)
+	case near == 1:
+		return 0.5, "similar to a recent chirp"
+	}
+	return 0, ""
+}
+
+// LinkDensityCheck penalizes chirps that are mostly links.
+type LinkDensityCheck struct {
+	MaxLinks int
+	MaxRatio float64
+}
+
+// Name -
+func (c LinkDensityCheck) Name() string {
+	return "link_density"
+}
+
+// Score -
+func (c LinkDensityCheck) Score(in Input) (float64, string) {
+	links := len(unfurl.FindURLs(in.Body))
+	if links == 0 {
+		return 0, ""
+	}
+
+	words := len(strings.Fields(in.Body))
+	ratio := float64(links) / float64(words)
+
+	score := 0.0
+	if links > c.MaxLinks {
+		score += 0.6
+	}
+	if ratio > c.MaxRatio {
+		score += 0.3
+	}
+	if score == 0 {
+		return 0, ""
+	}
+	return score, fmt.Sprintf("%d links in %d words", links, words)
+}
+
+// NewAccountCheck throttles accounts younger than MinAge that post more than
+// MaxPosts within Window.
+type NewAccountCheck struct {
+	MinAge   time.Duration
+	Window   time.Duration
+	MaxPosts int
+}
+
+// Name -
+func (c NewAccountCheck) Name() string {
+	return "new_account"
+}
+
+// Score -
+func (c NewAccountCheck) Score(in Input) (float64, string) {
+	if in.AuthorCreatedAt.IsZero() || in.Now.Sub(in.AuthorCreatedAt) >= c.MinAge {
+		return 0, ""
+	}
+
+	posts := 0
+	for _, recent := range in.Recent {
+		if in.Now.Sub(recent.CreatedAt) <= c.Window {
+			posts++
+		}
+	}
+
+	if posts >= c.MaxPosts {
+		return 1.0, fmt.Sprintf("new account posted %d chirps in %s", posts, c.Window)
+	}
+	return 0.1, "new account"
+}
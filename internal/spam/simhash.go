@@ -0,0 +1,62 @@
+package spam
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+const shingleSize = 4
+
+func normalize(body string) string {
+	words := strings.FieldsFunc(strings.ToLower(body), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '/' && r != '.' && r != ':'
+	})
+	return strings.Join(words, " ")
+}
+
+// simhash computes a 64-bit fingerprint from character shingles, which
+// suit short texts better than word shingles. Similar texts produce
+// fingerprints that differ in few bits.
+func simhash(normalized string) uint64 {
+	runes := []rune(normalized)
+	if len(runes) == 0 {
+		return 0
+	}
+
+	var shingles []string
+	if len(runes) < shingleSize {
+		shingles = []string{normalized}
+	} else {
+		for i := 0; i+shingleSize <= len(runes); i++ {
+			shingles = append(shingles, string(runes[i:i+shingleSize]))
+		}
+	}
+
+	var weights [64]int
+	for _, shingle := range shingles {
+		h := fnv.New64a()
+		h.Write([]byte(shingle))
+		sum := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if sum&(1<<uint(i)) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for i, w := range weights {
+		if w > 0 {
+			fingerprint |= 1 << uint(i)
+		}
+	}
+	return fingerprint
+}
+
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,115 @@
+package spam
+
+import (
+	"time"
+)
+
+// Verdict -
+type Verdict string
+
+const (
+	// VerdictAllow -
+	VerdictAllow Verdict = "allow"
+	// VerdictReview -
+	VerdictReview Verdict = "review"
+	// VerdictReject -
+	VerdictReject Verdict = "reject"
+)
+
+// Input is everything a check may look at for a chirp about to be created.
+type Input struct {
+	AuthorID        int
+	AuthorCreatedAt time.Time
+	Body            string
+	Recent          []RecentChirp
+	Now             time.Time
+}
+
+// RecentChirp -
+type RecentChirp struct {
+	Body      string
+	CreatedAt time.Time
+}
+
+// Signal is the contribution of a single check to the overall score.
+type Signal struct {
+	Check  string  `json:"check"`
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason"`
+}
+
+// Result -
+type Result struct {
+	Score   float64
+	Verdict Verdict
+	Signals []Signal
+}
+
+// Check scores one aspect of a chirp. A score of 0 means nothing
+// suspicious was found.
+type Check interface {
+	Name() string
+	Score(in Input) (float64, string)
+}
+
+// Pipeline runs every check and sums their scores into a verdict.
+type Pipeline struct {
+	checks          []Check
+	reviewThreshold float64
+	rejectThreshold float64
+}
+
+// NewPipeline -
+func NewPipeline(reviewThreshold, rejectThreshold float64, checks ...Check) *Pipeline {
+	return &Pipeline{
+		checks:          checks,
+		reviewThreshold: reviewThreshold,
+		rejectThreshold: rejectThreshold,
+	}
+}
+
+// DefaultPipeline -
+func DefaultPipeline() *Pipeline {
+	return NewPipeline(
+		0.5,
+		1.0,
+		DuplicateCheck{Window: 24 * time.Hour, MaxDistance: 10},
+		LinkDensityCheck{MaxLinks: 2, MaxRatio: 0.5},
+		NewAccountCheck{MinAge: 24 * time.Hour, Window: time.Hour, MaxPosts: 5},
+	)
+}
+
+// Add appends a check to the pipeline.
+func (p *Pipeline) Add(check Check) {
+	p.checks = append(p.checks, check)
+}
+
+// Evaluate -
+func (p *Pipeline) Evaluate(in Input) Result {
+	if in.Now.IsZero() {
+		in.Now = time.Now().UTC()
+	}
+
+	result := Result{Verdict: VerdictAllow}
+	for _, check := range p.checks {
+		score, reason := check.Score(in)
+		if score <= 0 {
+			continue
+		}
+		result.Score += score
+		result.Signals = append(result.Signals, Signal{
+			Check:  check.Name(),
+			Score:  score,
+			Reason: reason,
+		})
+	}
+
+	switch {
+	case result.Score >= p.rejectThreshold:
+		result.Verdict = VerdictReject
+	case result.Score >= p.reviewThreshold:
+		result.Verdict = VerdictReview
+	}
+
+	return result
+}
@@ -0,0 +1,126 @@
+package unfurl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTimeout = 5 * time.Second
+
+func TestIsBlockedAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "127.0.0.1", want: true},
+		{addr: "10.1.2.3", want: true},
+		{addr: "172.16.0.1", want: true},
+		{addr: "192.168.1.1", want: true},
+		{addr: "169.254.169.254", want: true},
+		{addr: "100.64.0.1", want: true},
+		{addr: "0.0.0.0", want: true},
+		{addr: "::1", want: true},
+		{addr: "::ffff:127.0.0.1", want: true},
+		{addr: "fd00::1", want: true},
+		{addr: "fe80::1", want: true},
+		{addr: "8.8.8.8", want: false},
+		{addr: "93.184.216.34", want: false},
+		{addr: "2606:4700::1111", want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.addr, func(t *testing.T) {
+			got := IsBlockedAddr(netip.MustParseAddr(tc.addr))
+			if got != tc.want {
+				t.Errorf("IsBlockedAddr(%s) = %v, want %v", tc.addr, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSafeDialerControl(t *testing.T) {
+	control := safeDialer(testTimeout).Control
+
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{address: "127.0.0.1:80", wantErr: true},
+		{address: "[::1]:443", wantErr: true},
+		{address: "10.0.0.1:8080", wantErr: true},
+		{address: "93.184.216.34:443", wantErr: false},
+		{address: "not-an-address", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.address, func(t *testing.T) {
+			err := control("tcp", tc.address, nil)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Control(%s) error = %v, wantErr %v", tc.address, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSafeClientRefusesInternalAddresses(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("internal server was reached")
+	}))
+	defer internal.Close()
+
+	// public stands in for an outside site that redirects to the internal
+	// one. It listens on loopback too, so it is reached through an
+	// unguarded transport; the redirect goes through the guarded one.
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+"/", http.StatusFound)
+	}))
+	defer public.Close()
+
+	client := NewSafeClient(testTimeout)
+	client.Transport = fakeHost{
+		host: "public.test",
+		addr: strings.TrimPrefix(public.URL, "http://"),
+		next: client.Transport,
+	}
+	fetcher := NewHTTPFetcher(client)
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "loopback", url: internal.URL + "/"},
+		{name: "redirect to loopback", url: "http://public.test/"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := fetcher.Fetch(context.Background(), tc.url)
+			if err == nil || !strings.Contains(err.Error(), "non-public address") {
+				t.Errorf("Fetch() error = %v, want a refused connection", err)
+			}
+		})
+	}
+}
+
+// fakeHost sends requests for host straight to addr and everything else
+// to next.
+type fakeHost struct {
+	host string
+	addr string
+	next http.RoundTripper
+}
+
+func (f fakeHost) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Hostname() != f.host {
+		return f.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Host = f.addr
+	return http.DefaultTransport.RoundTrip(req)
+}
@@ -0,0 +1,252 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	maxBodyBytes   = 1 << 20
+	maxRedirects   = 5
+	maxFieldLength = 300
+)
+
+// ErrNotHTML -
+var ErrNotHTML = errors.New("response is not an HTML document")
+
+// ErrNoMetadata -
+var ErrNoMetadata = errors.New("page has no preview metadata")
+
+// Card -
+type Card struct {
+	URL         string
+	Title       string
+	Description string
+	Image       string
+	SiteName    string
+}
+
+// Fetcher -
+type Fetcher interface {
+	Fetch(ctx context.Context, rawURL string) (Card, error)
+}
+
+// HTTPFetcher -
+type HTTPFetcher struct {
+	client *http.Client
+}
+
+// NewHTTPFetcher -
+func NewHTTPFetcher(client *http.Client) *HTTPFetcher {
+	return &HTTPFetcher{client: client}
+}
+
+// NewSafeClient returns an HTTP client that refuses to connect to loopback,
+// private, link-local and other non-public addresses, including after
+// redirects and DNS resolution.
+func NewSafeClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = safeDialer(timeout).DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkScheme(req.URL)
+		},
+	}
+}
+
+// Fetch -
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) (Card, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Card{}, err
+	}
+	if err := checkScheme(u); err != nil {
+		return Card{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Card{}, err
+	}
+	req.Header.Set("User-Agent", "Chirpybot/1.0 (+link preview)")
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Card{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Card{}, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "text/html" {
+		return Card{}, ErrNotHTML
+	}
+
+	card := parseMetadata(io.LimitReader(resp.Body, maxBodyBytes))
+	if card.Title == "" && card.Description == "" {
+		return Card{}, ErrNoMetadata
+	}
+	card.URL = resp.Request.URL.String()
+	if card.Image != "" {
+		card.Image = resolveReference(resp.Request.URL, card.Image)
+	}
+
+	return card, nil
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme: %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.New("missing host")
+	}
+	return nil
+}
+
+func resolveReference(base *url.URL, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	resolved := base.ResolveReference(u)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return ""
+	}
+	return resolved.String()
+}
+
+// parseMetadata reads OpenGraph and Twitter card tags from the document head.
+// OpenGraph values take precedence, then Twitter, then the <title> element.
+func parseMetadata(r io.Reader) Card {
+	og := map[string]string{}
+	twitter := map[string]string{}
+	title := ""
+
+	z := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return buildCard(og, twitter, title)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				return buildCard(og, twitter, title)
+			case "title":
+				inTitle = tt == html.StartTagToken
+			case "meta":
+				if !hasAttr {
+					continue
+				}
+				key, content := metaAttributes(z)
+				switch {
+				case strings.HasPrefix(key, "og:"):
+					if _, ok := og[key]; !ok {
+						og[key] = content
+					}
+				case strings.HasPrefix(key, "twitter:"):
+					if _, ok := twitter[key]; !ok {
+						twitter[key] = content
+					}
+				}
+			}
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return buildCard(og, twitter, title)
+			}
+		}
+	}
+}
+
+func metaAttributes(z *html.Tokenizer) (key, content string) {
+	for {
+		name, val, more := z.TagAttr()
+		switch strings.ToLower(string(name)) {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(string(val)))
+			}
+		case "content":
+			content = string(val)
+		}
+		if !more {
+			return key, content
+		}
+	}
+}
+
+func buildCard(og, twitter map[string]string, title string) Card {
+	first := func(values ...string) string {
+		for _, v := range values {
+			v = strings.Join(strings.Fields(v), " ")
+			if v != "" {
+				return truncate(v, maxFieldLength)
+			}
+		}
+		return ""
+	}
+
+	return Card{
+		Title:       first(og["og:title"], twitter["twitter:title"], title),
+		Description: first(og["og:description"], twitter["twitter:description"]),
+		Image:       first(og["og:image"], og["og:image:url"], twitter["twitter:image"]),
+		SiteName:    first(og["og:site_name"], twitter["twitter:site"]),
+	}
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// FindURLs returns the http(s) URLs in body, in order of appearance, with
+// trailing punctuation stripped.
+func FindURLs(body string) []string {
+	matches := urlPattern.FindAllString(body, -1)
+	urls := make([]string, 0, len(matches))
+	for _, m := range matches {
+		m = strings.TrimRight(m, ".,;:!?)]}'")
+		if _, err := url.ParseRequestURI(m); err != nil {
+			continue
+		}
+		urls = append(urls, m)
+	}
+	return urls
+}
@@ -0,0 +1,208 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want Card
+	}{
+		{
+			name: "opengraph",
+			doc: `<html><head>
+				<meta property="og:title" content="OG title">
+				<meta property="og:description" content="OG description">
+				<meta property="og:image" content="/img.png">
+				<meta property="og:site_name" content="Example">
+				<title>Page title</title>
+			</head></html>`,
+			want: Card{Title: "OG title", Description: "OG description", Image: "/img.png", SiteName: "Example"},
+		},
+		{
+			name: "twitter fallback",
+			doc: `<head>
+				<meta name="twitter:title" content="Tw title">
+				<meta name="twitter:description" content="Tw description">
+				<meta name="twitter:image" content="https://example.com/t.png">
+			</head>`,
+			want: Card{Title: "Tw title", Description: "Tw description", Image: "https://example.com/t.png"},
+		},
+		{
+			name: "opengraph wins over twitter",
+			doc: `<head>
+				<meta name="twitter:title" content="Tw title">
+				<meta property="og:title" content="OG title">
+			</head>`,
+			want: Card{Title: "OG title"},
+		},
+		{
+			name: "title element fallback",
+			doc:  `<head><title>  Just   a title </title></head>`,
+			want: Card{Title: "Just a title"},
+		},
+		{
+			name: "first value wins",
+			doc: `<head>
+				<meta property="og:title" content="First">
+				<meta property="og:title" content="Second">
+			</head>`,
+			want: Card{Title: "First"},
+		},
+		{
+			name: "stops at body",
+			doc:  `<head></head><body><meta property="og:title" content="In body"></body>`,
+			want: Card{},
+		},
+		{
+			name: "truncates long values",
+			doc:  `<head><meta property="og:title" content="` + strings.Repeat("a", maxFieldLength+10) + `"></head>`,
+			want: Card{Title: strings.Repeat("a", maxFieldLength)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseMetadata(strings.NewReader(tc.doc))
+			if got != tc.want {
+				t.Errorf("parseMetadata() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFindURLs(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "none",
+			body: "no links here",
+			want: []string{},
+		},
+		{
+			name: "in order",
+			body: "see https://a.example/x and http://b.example/y?z=1",
+			want: []string{"https://a.example/x", "http://b.example/y?z=1"},
+		},
+		{
+			name: "trailing punctuation",
+			body: "(look at https://a.example/page). Also https://b.example!",
+			want: []string{"https://a.example/page", "https://b.example"},
+		},
+		{
+			name: "other schemes ignored",
+			body: "ftp://a.example javascript:alert(1)",
+			want: []string{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := FindURLs(tc.body)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FindURLs() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHTTPFetcherFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<head>
+			<meta property="og:title" content="Hello">
+			<meta property="og:image" content="/img.png">
+		</head>`))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG"))
+	})
+	mux.HandleFunc("/bare", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<head></head><body>nothing</body>`))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	fetcher := NewHTTPFetcher(srv.Client())
+
+	tests := []struct {
+		name    string
+		url     string
+		want    Card
+		wantErr error
+	}{
+		{
+			name: "html page",
+			url:  srv.URL + "/page",
+			want: Card{URL: srv.URL + "/page", Title: "Hello", Image: srv.URL + "/img.png"},
+		},
+		{
+			name: "follows redirect",
+			url:  srv.URL + "/moved",
+			want: Card{URL: srv.URL + "/page", Title: "Hello", Image: srv.URL + "/img.png"},
+		},
+		{
+			name:    "not html",
+			url:     srv.URL + "/image",
+			wantErr: ErrNotHTML,
+		},
+		{
+			name:    "no metadata",
+			url:     srv.URL + "/bare",
+			wantErr: ErrNoMetadata,
+		},
+		{
+			name:    "error status",
+			url:     srv.URL + "/missing",
+			wantErr: errAny,
+		},
+		{
+			name:    "unsupported scheme",
+			url:     "file:///etc/passwd",
+			wantErr: errAny,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := fetcher.Fetch(context.Background(), tc.url)
+			checkErr(t, err, tc.wantErr)
+			if tc.wantErr == nil && got != tc.want {
+				t.Errorf("Fetch() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// errAny matches any non-nil error.
+var errAny = errors.New("any error")
+
+func checkErr(t *testing.T, err, want error) {
+	t.Helper()
+	switch {
+	case want == nil && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case want == errAny && err == nil:
+		t.Fatal("expected an error")
+	case want != nil && want != errAny && !errors.Is(err, want):
+		t.Fatalf("error = %v, want %v", err, want)
+	}
+}
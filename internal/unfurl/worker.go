@@ -0,0 +1,74 @@
+package unfurl
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Job -
+type Job struct {
+	ChirpID int
+	URL     string
+}
+
+// StoreFunc persists a fetched card for a chirp.
+type StoreFunc func(chirpID int, card Card) error
+
+// Worker fetches previews in the background so chirp creation never waits
+// on a remote site.
+type Worker struct {
+	fetcher Fetcher
+	store   StoreFunc
+	timeout time.Duration
+	jobs    chan Job
+}
+
+// NewWorker -
+func NewWorker(fetcher Fetcher, store StoreFunc, timeout time.Duration, queueSize int) *Worker {
+	return &Worker{
+		fetcher: fetcher,
+		store:   store,
+		timeout: timeout,
+		jobs:    make(chan Job, queueSize),
+	}
+}
+
+// Enqueue schedules a job and reports whether it was accepted. Jobs are
+// dropped rather than blocking the caller when the queue is full.
+func (w *Worker) Enqueue(job Job) bool {
+	select {
+	case w.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run processes jobs until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-w.jobs:
+			w.process(ctx, job)
+		}
+	}
+}
+
+func (w *Worker) process(ctx context.Context, job Job) {
+	fetchCtx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	card, err := w.fetcher.Fetch(fetchCtx, job.URL)
+	if err != nil {
+		log.Printf("Couldn't unfurl %s for chirp %d: %s", job.URL, job.ChirpID, err)
+		return
+	}
+
+	err = w.store(job.ChirpID, card)
+	if err != nil {
+		log.Printf("Couldn't store preview for chirp %d: %s", job.ChirpID, err)
+	}
+}
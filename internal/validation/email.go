@@ -0,0 +1,37 @@
+package validation
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+const maxEmailLength = 254
+
+// NormalizeEmail parses an RFC 5322 address and returns it in the form it
+// is stored and compared in: a bare, lower-cased addr-spec. Display names,
+// comments and addresses without a dotted domain are rejected.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", errors.New("is required")
+	}
+	if len(email) > maxEmailLength {
+		return "", errors.New("is too long")
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", errors.New("is not a valid email address")
+	}
+
+	at := strings.LastIndex(addr.Address, "@")
+	local, domain := addr.Address[:at], addr.Address[at+1:]
+	if local == "" || !strings.Contains(domain, ".") ||
+		strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") ||
+		strings.Contains(domain, "..") {
+		return "", errors.New("is not a valid email address")
+	}
+
+	return strings.ToLower(addr.Address), nil
+}
@@ -0,0 +1,106 @@
+package validation
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// BreachChecker reports whether a password is known from a data breach.
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// RangeFileChecker looks passwords up in a local copy of a k-anonymity
+// breach corpus laid out like the Pwned Passwords range API: dir holds one
+// file per 5-character SHA-1 prefix, each line being the remaining 35
+// characters of a hash, optionally followed by ":count". Only the file for
+// the password's prefix is read.
+type RangeFileChecker struct {
+	dir string
+}
+
+// NewRangeFileChecker -
+func NewRangeFileChecker(dir string) *RangeFileChecker {
+	return &RangeFileChecker{dir: dir}
+}
+
+// IsBreached -
+func (c *RangeFileChecker) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(c.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// PolicyError is returned when a password doesn't meet the policy, as
+// opposed to the check itself failing.
+type PolicyError struct {
+	Reason string
+}
+
+func (e PolicyError) Error() string {
+	return e.Reason
+}
+
+// PasswordPolicy -
+type PasswordPolicy struct {
+	MinLength int
+	MaxBytes  int
+	Breached  BreachChecker
+}
+
+// Check validates a new password for the account with the given email. It
+// returns a PolicyError if the password is unacceptable.
+func (p PasswordPolicy) Check(password, email string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return PolicyError{fmt.Sprintf("must be at least %d characters", p.MinLength)}
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		return PolicyError{fmt.Sprintf("must be at most %d bytes", p.MaxBytes)}
+	}
+
+	if email != "" {
+		lowered := strings.ToLower(password)
+		email = strings.ToLower(email)
+		local, _, _ := strings.Cut(email, "@")
+		if strings.Contains(lowered, email) || (len(local) >= 3 && strings.Contains(lowered, local)) {
+			return PolicyError{"must not contain your email address"}
+		}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return PolicyError{"has appeared in a data breach, choose another"}
+		}
+	}
+
+	return nil
+}
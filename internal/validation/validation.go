@@ -0,0 +1,40 @@
+package validation
+
+import (
+	"sort"
+	"strings"
+)
+
+// Errors maps request field names to a description of what is wrong with
+// them.
+type Errors map[string]string
+
+// Add records the first problem found for a field.
+func (e Errors) Add(field, message string) {
+	if _, ok := e[field]; !ok {
+		e[field] = message
+	}
+}
+
+// Err returns nil when there are no errors, so callers can write
+// `if err := errs.Err(); err != nil`.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, field+": "+e[field])
+	}
+	return strings.Join(parts, "; ")
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+
+	"github.com/nt2311-vn/Chirpy/internal/validation"
 )
 
 func respondWithError(w http.ResponseWriter, code int, msg string) {
@@ -18,6 +20,17 @@ func respondWithError(w http.ResponseWriter, code int, msg string) {
 	})
 }
 
+func respondWithFieldErrors(w http.ResponseWriter, code int, fields validation.Errors) {
+	type fieldErrorResponse struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+	respondWithJSON(w, code, fieldErrorResponse{
+		Error:  "Invalid input",
+		Fields: fields,
+	})
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	dat, err := json.Marshal(payload)
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// Accounts get a few free attempts before being locked out; an IP,
+	// which may be shared by many users, gets more.
+	accountLoginThreshold = 5
+	ipLoginThreshold      = 20
+	// loginLockoutBase is the first lockout. Each failure while past the
+	// threshold doubles it, up to loginLockoutMax.
+	loginLockoutBase = time.Minute
+	loginLockoutMax  = time.Hour
+	// loginFailureWindow is how long failures are remembered after the
+	// last one.
+	loginFailureWindow = 24 * time.Hour
+)
+
+// loginLimiter counts failed logins per key and locks a key out with
+// exponential backoff once it passes a threshold.
+type loginLimiter struct {
+	threshold int
+	mu        sync.Mutex
+	failures  map[string]loginFailures
+}
+
+type loginFailures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func newLoginLimiter(threshold int) *loginLimiter {
+	return &loginLimiter{
+		threshold: threshold,
+		failures:  map[string]loginFailures{},
+	}
+}
+
+// loginReservation is an attempt reserved by tryAcquire. lockout and count
+// describe the lockout the attempt causes and how many failures key has
+// with it.
+type loginReservation struct {
+	key             string
+	lockout         time.Duration
+	count           int
+	lockedUntil     time.Time
+	prevLockedUntil time.Time
+}
+
+// tryAcquire reserves an attempt for key, counting it as a failure straight
+// away so concurrent attempts can't all pass the threshold before any of
+// them fails. release takes the reservation back if the attempt succeeds.
+// If key is locked out it returns false and when the lockout ends.
+func (l *loginLimiter) tryAcquire(key string, now time.Time) (loginReservation, time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for k, f := range l.failures {
+		if now.Sub(f.lastFailure) > loginFailureWindow {
+			delete(l.failures, k)
+		}
+	}
+
+	f := l.failures[key]
+	if now.Before(f.lockedUntil) {
+		return loginReservation{}, f.lockedUntil, false
+	}
+
+	res := loginReservation{
+		key:             key,
+		prevLockedUntil: f.lockedUntil,
+	}
+	f.count++
+	f.lastFailure = now
+	if f.count >= l.threshold {
+		res.lockout = loginLockoutBase
+		for i := l.threshold; i < f.count && res.lockout < loginLockoutMax; i++ {
+			res.lockout *= 2
+		}
+		res.lockout = min(res.lockout, loginLockoutMax)
+		f.lockedUntil = now.Add(res.lockout)
+	}
+	res.count = f.count
+	res.lockedUntil = f.lockedUntil
+
+	l.failures[key] = f
+	return res, time.Time{}, true
+}
+
+// release takes back a reservation whose attempt didn't fail, along with
+// the lockout it caused.
+func (l *loginLimiter) release(res loginReservation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.failures[res.key]
+	if !ok {
+		return
+	}
+
+	f.count--
+	if f.lockedUntil.Equal(res.lockedUntil) {
+		f.lockedUntil = res.prevLockedUntil
+	}
+	if f.count <= 0 {
+		delete(l.failures, res.key)
+		return
+	}
+	l.failures[res.key] = f
+}
+
+// reset forgets the failures for key after a successful login.
+func (l *loginLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+}
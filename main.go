@@ -1,12 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/nt2311-vn/Chirpy/internal/auth"
 	"github.com/nt2311-vn/Chirpy/internal/database"
+	"github.com/nt2311-vn/Chirpy/internal/mail"
+	"github.com/nt2311-vn/Chirpy/internal/profanity"
+	"github.com/nt2311-vn/Chirpy/internal/spam"
+	"github.com/nt2311-vn/Chirpy/internal/unfurl"
+	"github.com/nt2311-vn/Chirpy/internal/validation"
 
 	"github.com/joho/godotenv"
 )
@@ -15,6 +24,26 @@ type apiConfig struct {
 	fileserverHits int
 	DB             *database.DB
 	jwtSecret      string
+	keyring        *auth.Keyring
+	unfurler       *unfurl.Worker
+	adminKey       string
+	profanity      *profanity.Filter
+	profanityFile  string
+	spam           *spam.Pipeline
+	exportsDir     string
+	mailer         mail.Mailer
+	publicURL      string
+	// requireVerifiedEmail blocks chirping until the user's email is
+	// verified.
+	requireVerifiedEmail bool
+	passwordPolicy       validation.PasswordPolicy
+	passwords            *auth.PasswordHasher
+	// mfaAttempts counts wrong codes per MFA challenge.
+	mfaAttempts *attemptCounter
+	// accountLogins and ipLogins lock out repeated failed logins per
+	// email and per client IP.
+	accountLogins *loginLimiter
+	ipLogins      *loginLimiter
 }
 
 func main() {
@@ -28,6 +57,29 @@ func main() {
 		log.Fatal("JWT_SECRET environment variable is not set")
 	}
 
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + port
+	}
+
+	// JWT_SECRET keeps verifying tokens issued before the keyring existed.
+	// When JWT_KEYS_DIR is set new tokens are signed with the asymmetric
+	// key named by JWT_SIGNING_KEY_ID, or the last one in the directory.
+	keyring := auth.NewKeyring(publicURL, publicURL+"/api")
+	keyring.Add(auth.NewSecretKey("hs256", []byte(jwtSecret)))
+	err := keyring.SetFallback("hs256")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if keysDir := os.Getenv("JWT_KEYS_DIR"); keysDir != "" {
+		err = keyring.LoadDir(keysDir, os.Getenv("JWT_SIGNING_KEY_ID"))
+	} else {
+		err = keyring.SetActive("hs256")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	db, err := database.NewDB("database.json")
 	if err != nil {
 		log.Fatal(err)
@@ -42,12 +94,104 @@ func main() {
 		}
 	}
 
+	unfurler := unfurl.NewWorker(
+		unfurl.NewHTTPFetcher(unfurl.NewSafeClient(5*time.Second)),
+		func(chirpID int, card unfurl.Card) error {
+			_, err := db.SetChirpPreview(chirpID, database.Preview{
+				URL:         card.URL,
+				Title:       card.Title,
+				Description: card.Description,
+				Image:       card.Image,
+				SiteName:    card.SiteName,
+			})
+			return err
+		},
+		10*time.Second,
+		100,
+	)
+	go unfurler.Run(context.Background())
+
+	profanityFilter, err := profanity.NewFilter(profanity.DefaultRules())
+	if err != nil {
+		log.Fatal(err)
+	}
+	profanityFile := os.Getenv("PROFANITY_FILE")
+	if profanityFile != "" {
+		err := profanityFilter.LoadFile(profanityFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Fatal(err)
+		}
+		go profanityFilter.Watch(context.Background(), profanityFile, 10*time.Second)
+	}
+
+	var mailer mail.Mailer = mail.NewLogMailer(os.Stdout)
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		mailer = mail.NewSMTPMailer(
+			smtpAddr,
+			os.Getenv("MAIL_FROM"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+		)
+	} else if mailLog := os.Getenv("MAIL_LOG_FILE"); mailLog != "" {
+		f, err := os.OpenFile(mailLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		mailer = mail.NewLogMailer(f)
+	}
+
+	passwords, err := passwordHasherFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	passwordPolicy := validation.PasswordPolicy{
+		MinLength: 8,
+		MaxBytes:  1024,
+	}
+	if passwords.Algorithm() == auth.AlgorithmBcrypt {
+		// bcrypt refuses passwords longer than 72 bytes.
+		passwordPolicy.MaxBytes = 72
+	}
+	if breachedDir := os.Getenv("BREACHED_PASSWORDS_DIR"); breachedDir != "" {
+		passwordPolicy.Breached = validation.NewRangeFileChecker(breachedDir)
+	}
+
 	apiCfg := apiConfig{
 		fileserverHits: 0,
 		DB:             db,
 		jwtSecret:      jwtSecret,
+		keyring:        keyring,
+		unfurler:       unfurler,
+		adminKey:       os.Getenv("ADMIN_API_KEY"),
+		profanity:      profanityFilter,
+		profanityFile:  profanityFile,
+		spam:           spam.DefaultPipeline(),
+		exportsDir:     "exports",
+		mailer:         mailer,
+		publicURL:      publicURL,
+
+		requireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+		passwordPolicy:       passwordPolicy,
+		passwords:            passwords,
+		mfaAttempts:          newAttemptCounter(),
+		accountLogins:        newLoginLimiter(accountLoginThreshold),
+		ipLogins:             newLoginLimiter(ipLoginThreshold),
+	}
+
+	failed, err := db.FailPendingExports()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if failed > 0 {
+		log.Printf("Marked %d interrupted exports as failed", failed)
 	}
 
+	go apiCfg.purgeDeletedUsers(time.Hour)
+	go apiCfg.cleanupExports(time.Hour)
+	go apiCfg.sweepExpiredTokens(time.Hour)
+
 	mux := http.NewServeMux()
 	fsHandler := apiCfg.middlewareMetricsInc(
 		http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))),
@@ -59,17 +203,60 @@ func main() {
 
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
+	mux.HandleFunc("POST /api/keys", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerAPIKeysCreate))
+	mux.HandleFunc("GET /api/keys", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerAPIKeysGet))
+	mux.HandleFunc("DELETE /api/keys/{keyID}", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerAPIKeysDelete))
+	mux.HandleFunc("GET /api/sessions", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerSessionsGet))
+	mux.HandleFunc("DELETE /api/sessions", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerSessionsDeleteAll))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerSessionsDelete))
+	mux.HandleFunc("POST /api/oauth/clients", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerOAuthClientsCreate))
+	mux.HandleFunc("GET /api/oauth/clients", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerOAuthClientsGet))
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerOAuthClientsDelete))
+	mux.HandleFunc("GET /api/oauth/authorize", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerOAuthAuthorizeGet))
+	mux.HandleFunc("POST /api/oauth/authorize", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerOAuthAuthorizePost))
+	mux.HandleFunc("POST /oauth/token", apiCfg.handlerOAuthToken)
+	mux.HandleFunc("POST /oauth/introspect", apiCfg.handlerOAuthIntrospect)
+	mux.HandleFunc("POST /oauth/revoke", apiCfg.handlerOAuthRevoke)
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.handlerLoginMFA)
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.handlerPasswordForgot)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.handlerPasswordReset)
 
 	mux.HandleFunc("POST /api/users", apiCfg.handlerUsersCreate)
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerUsersUpdate)
+	mux.HandleFunc("PUT /api/users", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersUpdate))
+	mux.HandleFunc("PATCH /api/users", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersPatch))
+	mux.HandleFunc("DELETE /api/users", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersDelete))
+	mux.HandleFunc("POST /api/users/mfa", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersMFAEnroll))
+	mux.HandleFunc("POST /api/users/mfa/verify", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersMFAConfirm))
+	mux.HandleFunc("DELETE /api/users/mfa", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersMFADisable))
+	mux.HandleFunc("POST /api/users/verify", apiCfg.handlerUsersVerify)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersVerifyResend))
+	mux.HandleFunc("POST /api/users/export", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersExportCreate))
+	mux.HandleFunc("GET /api/users/export/{exportID}", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersExportGet))
+	mux.HandleFunc("GET /api/users/export/{exportID}/download", apiCfg.handlerUsersExportDownload)
+	mux.HandleFunc("GET /api/users/{idOrHandle}", apiCfg.handlerUsersGet)
+
+	mux.HandleFunc("POST /api/chirps", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerChirpsCreate))
+	mux.HandleFunc("GET /api/chirps/", apiCfg.middlewareOptionalAuth(auth.ScopeChirpsRead, apiCfg.handlerChirpsRetrieve))
+	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.middlewareOptionalAuth(auth.ScopeChirpsRead, apiCfg.handlerChirpsGet))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.middlewareAuth(auth.ScopeChirpsWrite, apiCfg.handlerChirpDelete))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/reports", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerChirpReportsCreate))
 
-	mux.HandleFunc("POST /api/chirps", apiCfg.handlerChirpsCreate)
-	mux.HandleFunc("GET /api/chirps/", apiCfg.handlerChirpsRetrieve)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerChirpsGet)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerChirpDelete)
+	mux.HandleFunc("POST /api/users/{userID}/reports", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUserReportsCreate))
+	mux.HandleFunc("POST /api/users/{userID}/block", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersBlock))
+	mux.HandleFunc("DELETE /api/users/{userID}/block", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersUnblock))
+	mux.HandleFunc("POST /api/users/{userID}/mute", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersMute))
+	mux.HandleFunc("DELETE /api/users/{userID}/mute", apiCfg.middlewareAuth(auth.ScopeAccount, apiCfg.handlerUsersUnmute))
 
 	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
+	mux.HandleFunc("GET /admin/profanity", apiCfg.middlewareAdmin(apiCfg.handlerProfanityGet))
+	mux.HandleFunc("PUT /admin/profanity", apiCfg.middlewareAdmin(apiCfg.handlerProfanityUpdate))
+	mux.HandleFunc("GET /admin/reports", apiCfg.middlewareAdmin(apiCfg.handlerAdminReportsList))
+	mux.HandleFunc("POST /admin/reports/{reportID}/actions", apiCfg.middlewareAdmin(apiCfg.handlerAdminReportsAction))
+	mux.HandleFunc("GET /admin/audit", apiCfg.middlewareAdmin(apiCfg.handlerAdminAuditLog))
+	mux.HandleFunc("PUT /admin/users/{userID}/state", apiCfg.middlewareAdmin(apiCfg.handlerAdminUserStateUpdate))
+	mux.HandleFunc("DELETE /admin/users/{userID}", apiCfg.middlewareAdmin(apiCfg.handlerAdminUsersDelete))
 
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPolkaWebhooks)
 
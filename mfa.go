@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"github.com/nt2311-vn/Chirpy/internal/database"
+)
+
+const (
+	// mfaChallengeTTL is how long a user has to enter their code after the
+	// password step.
+	mfaChallengeTTL = 5 * time.Minute
+	// maxMFAAttempts is how many wrong codes a challenge tolerates before
+	// the password has to be entered again.
+	maxMFAAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+func (cfg *apiConfig) respondWithMFAChallenge(w http.ResponseWriter, user database.User) {
+	type response struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+
+	token, err := auth.MakeJWT(user.ID, cfg.keyring, mfaChallengeTTL, auth.TokenTypeMFAChallenge)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create MFA challenge")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		MFARequired: true,
+		MFAToken:    token,
+	})
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused
+// recovery code. A code is only ever accepted once.
+func (cfg *apiConfig) checkSecondFactor(user database.User, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		err := cfg.DB.UseRecoveryCode(user.ID, auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode)))
+		if errors.Is(err, database.ErrTokenInvalid) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	secret, err := cfg.openMFASecret(user.MFASecret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, time.Now().UTC())
+	if !ok {
+		return false, nil
+	}
+
+	err = cfg.DB.UseMFAStep(user.ID, step)
+	if errors.Is(err, database.ErrTokenInvalid) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// mfaKey derives the key TOTP secrets are sealed with, so a copy of the
+// database alone isn't enough to generate codes.
+func (cfg *apiConfig) mfaKey() []byte {
+	mac := hmac.New(sha256.New, []byte(cfg.jwtSecret))
+	mac.Write([]byte("chirpy-mfa-secret"))
+	return mac.Sum(nil)
+}
+
+func (cfg *apiConfig) sealMFASecret(secret string) (string, error) {
+	block, err := aes.NewCipher(cfg.mfaKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (cfg *apiConfig) openMFASecret(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(cfg.mfaKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("sealed secret is too short")
+	}
+
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// attemptCounter counts failed attempts per key, forgetting keys once they
+// expire.
+type attemptCounter struct {
+	mu       sync.Mutex
+	attempts map[string]attempt
+}
+
+type attempt struct {
+	count     int
+	expiresAt time.Time
+}
+
+func newAttemptCounter() *attemptCounter {
+	return &attemptCounter{attempts: map[string]attempt{}}
+}
+
+// fail records a failed attempt and reports how many there have been.
+func (c *attemptCounter) fail(key string, expiresAt time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, a := range c.attempts {
+		if now.After(a.expiresAt) {
+			delete(c.attempts, k)
+		}
+	}
+
+	a := c.attempts[key]
+	a.count++
+	a.expiresAt = expiresAt
+	c.attempts[key] = a
+	return a.count
+}
+
+// exhaust uses up every attempt for key.
+func (c *attemptCounter) exhaust(key string, limit int, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempts[key] = attempt{count: limit, expiresAt: expiresAt}
+}
+
+func (c *attemptCounter) count(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.attempts[key].count
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/nt2311-vn/Chirpy/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordHasherFromEnv builds the hasher for new passwords.
+// PASSWORD_HASH_ALGORITHM picks argon2id (the default) or bcrypt; the
+// ARGON2_* and BCRYPT_COST variables override their costs. Existing hashes
+// of either kind keep working and are upgraded as users log in.
+func passwordHasherFromEnv() (*auth.PasswordHasher, error) {
+	switch algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm {
+	case "", auth.AlgorithmArgon2id:
+		params := auth.DefaultArgon2Params
+		memory, err := envUint("ARGON2_MEMORY_KIB", uint64(params.Memory), 32)
+		if err != nil {
+			return nil, err
+		}
+		iterations, err := envUint("ARGON2_ITERATIONS", uint64(params.Iterations), 32)
+		if err != nil {
+			return nil, err
+		}
+		parallelism, err := envUint("ARGON2_PARALLELISM", uint64(params.Parallelism), 8)
+		if err != nil {
+			return nil, err
+		}
+		params.Memory = uint32(memory)
+		params.Iterations = uint32(iterations)
+		params.Parallelism = uint8(parallelism)
+		if params.Memory < 8*uint32(params.Parallelism) || params.Iterations == 0 || params.Parallelism == 0 {
+			return nil, fmt.Errorf("invalid argon2id parameters m=%d,t=%d,p=%d", params.Memory, params.Iterations, params.Parallelism)
+		}
+		return auth.NewArgon2idHasher(params), nil
+	case auth.AlgorithmBcrypt:
+		cost, err := envUint("BCRYPT_COST", uint64(bcrypt.DefaultCost), 8)
+		if err != nil {
+			return nil, err
+		}
+		if int(cost) < bcrypt.MinCost || int(cost) > bcrypt.MaxCost {
+			return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return auth.NewBcryptHasher(int(cost)), nil
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASH_ALGORITHM %q", algorithm)
+	}
+}
+
+func envUint(name string, def uint64, bitSize int) (uint64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
+}
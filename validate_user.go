@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/nt2311-vn/Chirpy/internal/validation"
+)
+
+// normalizeEmailField returns the normalized form of email, recording a
+// problem with it under field in errs.
+func normalizeEmailField(errs validation.Errors, field, email string) string {
+	normalized, err := validation.NormalizeEmail(email)
+	if err != nil {
+		errs.Add(field, err.Error())
+		return email
+	}
+	return normalized
+}
+
+// checkPasswordField records a password policy violation under field in
+// errs. It only returns an error if the policy couldn't be checked.
+func (cfg *apiConfig) checkPasswordField(errs validation.Errors, field, password, email string) error {
+	err := cfg.passwordPolicy.Check(password, email)
+	var policyErr validation.PolicyError
+	if errors.As(err, &policyErr) {
+		errs.Add(field, policyErr.Reason)
+		return nil
+	}
+	return err
+}